@@ -48,21 +48,21 @@ func printOption(w io.Writer, f *flag.Flag) {
 func PrintUsage(flags map[string]*flag.Flag) {
 
 	w := tabwriter.NewWriter(os.Stdout, 30, 0, 1, ' ', tabwriter.TabIndent)
-	fmt.Fprintln(w, "Usage: go-dump  --destination path [--databases str] [--tables str] [--all-databases] [--dry-run | --execute ] [--help] [--debug] [--quiet] [--version] [--lock-tables] [--consistent] [--isolation-level str] [--channel-buffer-size num] [--chunk-size num] [--tables-without-uniquekey str] [--threads num] [--mysql-user str] [--mysql-password str] [--mysql-host str] [--mysql-port num] [--mysql-socket path] [--add-drop-table] [--get-master-status] [--get-slave-status] [--output-chunk-size num] [--skip-use-database] [--compress] [--compress-level] [--ini-files str]")
+	fmt.Fprintln(w, "Usage: go-dump  --destination path [--databases str] [--tables str] [--all-databases] [--dry-run | --execute ] [--help] [--debug] [--quiet] [--version] [--lock-tables] [--lock-mode str] [--lock-wait-timeout num] [--long-query-guard num] [--long-query-action str] [--long-query-wait num] [--consistent] [--isolation-level str] [--channel-buffer-size num] [--chunk-size num] [--chunk-keys str] [--chunk-strategy str] [--chunk-threads num] [--chunk-target-size str] [--chunk-target-time num] [--tables-without-uniquekey str] [--threads num] [--mysql-user str] [--mysql-password [str]] [--mysql-password-env str] [--mysql-password-file path] [--mysql-password-prompt] [--login-path str] [--dsn url] [--session-variables str] [--mysql-host str] [--mysql-port num] [--mysql-socket path] [--ssl-mode str] [--ssl-ca path] [--ssl-cert path] [--ssl-key path] [--add-drop-table] [--get-master-status | --get-source-status] [--get-slave-status | --get-replica-status] [--replication-data-format str] [--replication-syntax str] [--replication-gtid] [--output-chunk-size num] [--skip-use-database] [--exclude-columns str] [--hex-blob] [--insert-mode str] [--no-data] [--no-create-info] [--output-layout str] [--max-file-size str] [--compress] [--compress-level] [--ini-files str] [--config path] [--masking-rules path] [--masking-salt str]")
 
-	fmt.Fprintln(w, "go-dump dumps a database or a table from a MySQL server and creates the SQL statements to recreate a table. This tool create one file per table per thread in the destination directory")
+	fmt.Fprintln(w, "go-dump dumps a database or a table from a MySQL server and creates the SQL statements to recreate a table. This tool create one file per table per thread in the destination directory by default")
 	fmt.Fprint(w, "Example: go-dump --destination /tmp/dbdump --databases mydb --mysql-user myuser --mysql-password password\n\n")
 	fmt.Fprint(w, "Options description\n\n")
 
 	fmt.Fprintln(w, "# General:")
 	for _, opt := range []string{"help", "dry-run", "execute", "debug", "quiet", "version",
-		"lock-tables", "channel-buffer-size", "chunk-size", "tables-without-uniquekey",
-		"threads", "compress", "compress-level", "consistent", "isolation-level", "ini-file"} {
+		"lock-tables", "lock-mode", "lock-wait-timeout", "long-query-guard", "long-query-action", "long-query-wait", "channel-buffer-size", "chunk-size", "chunk-keys", "chunk-strategy", "chunk-threads", "chunk-target-size", "chunk-target-time", "tables-without-uniquekey",
+		"threads", "compress", "compress-level", "consistent", "isolation-level", "ini-file", "config"} {
 		printOption(w, flags[opt])
 	}
 
 	fmt.Fprintln(w, "\n# MySQL options:")
-	for _, opt := range []string{"mysql-user", "mysql-password", "mysql-host", "mysql-port", "mysql-socket"} {
+	for _, opt := range []string{"mysql-user", "mysql-password", "mysql-password-env", "mysql-password-file", "mysql-password-prompt", "login-path", "dsn", "session-variables", "mysql-host", "mysql-port", "mysql-socket", "ssl-mode", "ssl-ca", "ssl-cert", "ssl-key"} {
 		printOption(w, flags[opt])
 	}
 
@@ -71,7 +71,12 @@ func PrintUsage(flags map[string]*flag.Flag) {
 		printOption(w, flags[opt])
 	}
 	fmt.Fprintln(w, "\n# Output options:")
-	for _, opt := range []string{"destination", "add-drop-table", "get-master-status", "get-slave-status", "output-chunk-size", "skip-use-database"} {
+	for _, opt := range []string{"destination", "add-drop-table", "get-master-status", "get-source-status", "get-slave-status", "get-replica-status", "replication-data-format", "replication-syntax", "replication-gtid", "output-chunk-size", "skip-use-database", "exclude-columns", "hex-blob", "insert-mode", "no-data", "no-create-info", "output-layout", "max-file-size"} {
+		printOption(w, flags[opt])
+	}
+
+	fmt.Fprintln(w, "\n# Masking options:")
+	for _, opt := range []string{"masking-rules", "masking-salt"} {
 		printOption(w, flags[opt])
 	}
 	w.Flush()
@@ -86,6 +91,7 @@ func main() {
 	var (
 		flagHelp, flagVersion bool
 		flagIniFile           string
+		flagConfigFile        string
 	)
 
 	var consitent = true
@@ -95,41 +101,115 @@ func main() {
 	flag.StringVar(&dumpOptions.MySQLHost.HostName, "mysql-host", "localhost", "MySQL hostname.")
 	flag.StringVar(&dumpOptions.MySQLHost.SocketFile, "mysql-socket", "", "MySQL socket file.")
 	flag.IntVar(&dumpOptions.MySQLHost.Port, "mysql-port", 3306, "MySQL port number")
+	flag.StringVar(&dumpOptions.MySQLHost.SSLMode, "ssl-mode", "", "TLS mode of the connections. Valid modes are: DISABLED, PREFERRED, REQUIRED, VERIFY_CA (verify the server certificate with --ssl-ca) and VERIFY_IDENTITY (verify also the host name). Default VERIFY_CA with --ssl-ca, REQUIRED with --ssl-cert and PREFERRED otherwise. PREFERRED can't be used with --ssl-cert.")
+	flag.StringVar(&dumpOptions.MySQLHost.SSLCA, "ssl-ca", "", "File with the certificate authority to verify the server certificate.")
+	flag.StringVar(&dumpOptions.MySQLHost.SSLCert, "ssl-cert", "", "File with the client certificate.")
+	flag.StringVar(&dumpOptions.MySQLHost.SSLKey, "ssl-key", "", "File with the key of the client certificate.")
 	flag.StringVar(&dumpOptions.MySQLCredentials.User, "mysql-user", "root", "MySQL user name.")
-	flag.StringVar(&dumpOptions.MySQLCredentials.Password, "mysql-password", "", "MySQL password.")
+	flag.StringVar(&dumpOptions.MySQLCredentials.Password, "mysql-password", "", "MySQL password. Without a value the password is asked in the terminal.")
+	flag.StringVar(&dumpOptions.TemporalOptions.PasswordEnv, "mysql-password-env", "", "Environment variable with the MySQL password.")
+	flag.StringVar(&dumpOptions.TemporalOptions.PasswordFile, "mysql-password-file", "", "File with the MySQL password in the first line.")
+	flag.BoolVar(&dumpOptions.TemporalOptions.PasswordPrompt, "mysql-password-prompt", false, "Ask for the MySQL password in the terminal.")
+	flag.StringVar(&dumpOptions.TemporalOptions.LoginPath, "login-path", "", "Read the MySQL host and credentials from this login path of the .mylogin.cnf file created with mysql_config_editor.")
+	flag.StringVar(&dumpOptions.TemporalOptions.DSN, "dsn", "", "URL with the MySQL connection settings, for example \"mysql://user@host:3306/?timeout=5s\". The query parameters are passed to the driver, except socket that sets the socket file.")
+	flag.StringVar(&dumpOptions.TemporalOptions.SessionVariables, "session-variables", "", "List of comma separated session variables of the connections that read the data, for example \"net_write_timeout=7200,sql_mode=''\". They override the defaults: time_zone='+00:00', net_read_timeout=3600, net_write_timeout=3600, wait_timeout=28800, innodb_lock_wait_timeout=3600 and max_execution_time=0 (max_statement_time=0 in MariaDB).")
 	flag.IntVar(&dumpOptions.Threads, "threads", 1, "Number of threads to use.")
 	flag.Uint64Var(&dumpOptions.ChunkSize, "chunk-size", 1000, "Chunk size to get the rows.")
+	flag.StringVar(&dumpOptions.ChunkStrategy, "chunk-strategy", "offset", "Strategy to find the limits of the chunks. Valid strategies are: 'offset' (read the key at each chunk size, the chunks have the same number of rows), 'range' (split the range between the minimum and maximum of the key, faster for dense keys like auto increment columns), 'statistics' (split the histogram of the key, MySQL 8.0 or newer) and 'sample' (split a random sample of the keys read in a single query).")
+	flag.IntVar(&dumpOptions.ChunkThreads, "chunk-threads", 4, "Number of tables whose chunks are created at the same time.")
+	flag.StringVar(&dumpOptions.TemporalOptions.ChunkTargetSize, "chunk-target-size", "0", "Size of the rows of each chunk, for example 64M. The chunk size of each table is calculated with the average row length of the table statistics, the tables without statistics use --chunk-size. 0 means that all the tables use --chunk-size.")
+	flag.IntVar(&dumpOptions.ChunkTargetTime, "chunk-target-time", 0, "Seconds to dump each chunk. The chunks created with the offset strategy are resized with the time measured to dump the previous chunks of the table, between a tenth and ten times the initial chunk size. 0 disables the resizing.")
+	flag.StringVar(&dumpOptions.TemporalOptions.ChunkKeys, "chunk-keys", "", "List of comma separated columns used to split the tables instead of the primary or unique key, for example \"mydb.mytable.mycolumn\". The column must be an indexed integer column without NULL values.")
 	flag.Uint64Var(&dumpOptions.OutputChunkSize, "output-chunk-size", 0, "Chunk size to output the rows.")
 	flag.IntVar(&dumpOptions.ChannelBufferSize, "channel-buffer-size", 1000, "Task channel buffer size.")
 	flag.BoolVar(&dumpOptions.LockTables, "lock-tables", true, "Lock tables to get consistent backup.")
+	flag.StringVar(&dumpOptions.LockMode, "lock-mode", "auto", "Lock to get a consistent backup. Valid modes are: 'auto' (backup locks when the server supports them, otherwise FLUSH TABLES WITH READ LOCK with --all-databases and LOCK TABLES for the rest), 'ftwrl' (FLUSH TABLES WITH READ LOCK), 'lock-tables' (LOCK TABLES ... READ) and 'backup-locks' (LOCK INSTANCE FOR BACKUP or Percona LOCK TABLES FOR BACKUP).")
 	flag.StringVar(&dumpOptions.TablesWithoutUKOption, "tables-without-uniquekey", "error", "Action to have with tables without any primary or unique key. Valid actions are: 'error', 'single-chunk'.")
+	flag.IntVar(&dumpOptions.LockWaitTimeout, "lock-wait-timeout", 60, "Seconds to wait for the locks. After this time the lock statement is killed and the dump stops. 0 means no limit.")
+	flag.IntVar(&dumpOptions.LongQueryGuard, "long-query-guard", 60, "Before FLUSH TABLES WITH READ LOCK, look for queries running for more than these seconds. 0 disables the check.")
+	flag.StringVar(&dumpOptions.LongQueryAction, "long-query-action", "abort", "Action to take with the long running queries. Valid actions are: 'abort' (stop the dump), 'wait' (wait for the queries to finish) and 'kill' (kill the queries).")
+	flag.IntVar(&dumpOptions.LongQueryWait, "long-query-wait", 300, "Seconds to wait for the long running queries with the actions 'wait' and 'kill' before stopping the dump.")
 	flag.BoolVar(&dumpOptions.TemporalOptions.Debug, "debug", false, "Display debug information.")
 	flag.StringVar(&dumpOptions.DestinationDir, "destination", "", "Directory to store the dumps.")
 	flag.BoolVar(&flagHelp, "help", false, "Display this message.")
 	flag.BoolVar(&flagVersion, "version", false, "Display version and exit.")
 	flag.BoolVar(&dumpOptions.TemporalOptions.DryRun, "dry-run", false, "Just calculate the number of chaunks per table and display it.")
 	flag.BoolVar(&dumpOptions.TemporalOptions.Execute, "execute", false, "Execute the dump.")
-	flag.BoolVar(&dumpOptions.SkipUseDatabase, "skip-use-database", false, "Skip USE \"database\" in the dump.")
+	flag.BoolVar(&dumpOptions.SkipUseDatabase, "skip-use-database", false, "Skip USE \"database\" in the dump. The 'single' output layout always selects the databases.")
 	flag.BoolVar(&dumpOptions.GetMasterStatus, "get-master-status", false, "Get the master data.")
 	flag.BoolVar(&dumpOptions.GetSlaveStatus, "get-slave-status", false, "Get the slave data.")
+	flag.BoolVar(&dumpOptions.GetMasterStatus, "get-source-status", false, "Alias of --get-master-status.")
+	flag.BoolVar(&dumpOptions.GetSlaveStatus, "get-replica-status", false, "Alias of --get-slave-status.")
+	flag.StringVar(&dumpOptions.ReplicationDataFormat, "replication-data-format", "text", "Format of the master and slave data files. Valid formats are: 'text' and 'sql' (the statements to configure a replica).")
+	flag.StringVar(&dumpOptions.ReplicationSyntax, "replication-syntax", "auto", "Syntax of the statements with --replication-data-format=sql. Valid values are: 'auto' (CHANGE REPLICATION SOURCE TO if the server supports it), 'master' (CHANGE MASTER TO) and 'source' (CHANGE REPLICATION SOURCE TO).")
+	flag.BoolVar(&dumpOptions.ReplicationGTID, "replication-gtid", true, "Use the GTID position in the statements when it is available. The binary log coordinates are written as a comment.")
+	flag.StringVar(&dumpOptions.OutputLayout, "output-layout", "thread", "Layout of the output files. Valid layouts are: 'thread' (one file per table per thread), 'chunk' (one file per chunk named database.table.sequence.sql), 'database' (one SQL file per database) and 'single' (one SQL file for the whole dump).")
+	flag.StringVar(&dumpOptions.TemporalOptions.MaxFileSize, "max-file-size", "0", "Continue in a new numbered file when a data file reaches this size, for example 512M or 2G. The size is calculated before the compression. 0 means no limit.")
+	flag.BoolVar(&dumpOptions.NoData, "no-data", false, "Do not dump the rows, only the tables definitions.")
+	flag.BoolVar(&dumpOptions.NoCreateInfo, "no-create-info", false, "Do not dump the tables definitions, only the rows.")
 	flag.BoolVar(&dumpOptions.AddDropTable, "add-drop-table", false, "Add drop table before create table.")
+	flag.StringVar(&dumpOptions.InsertMode, "insert-mode", "insert", "Statement to insert the rows. Valid modes are: 'insert', 'ignore' (INSERT IGNORE), 'replace' (REPLACE) and 'update' (INSERT ... ON DUPLICATE KEY UPDATE).")
+	flag.BoolVar(&dumpOptions.HexBlob, "hex-blob", false, "Write the BINARY, VARBINARY, BLOB and BIT columns as hexadecimal literals.")
 	flag.BoolVar(&dumpOptions.Compress, "compress", false, "Enable compression to the output files.")
 	flag.IntVar(&dumpOptions.CompressLevel, "compress-level", 1, "Compression level from 1 (best speed) to 9 (best compression).")
 	flag.BoolVar(&dumpOptions.TemporalOptions.Quiet, "quiet", false, "Do not display INFO messages during the process.")
 	flag.StringVar(&dumpOptions.TemporalOptions.IsolationLevel, "isolation-level", "REPEATABLE READ", "Isolation level to use. If you need a consitent backup, leave the default 'REPEATABLE READ', other options READ COMMITTED, READ UNCOMMITTED and SERIALIZABLE.")
 	flag.BoolVar(&dumpOptions.Consistent, "consistent", true, "Get a consistent backup.")
 	flag.StringVar(&flagIniFile, "ini-file", "", "INI file to read the configuration options.")
+	flag.StringVar(&flagConfigFile, "config", "", "YAML file to read the configuration options and the options of each table.")
+	flag.StringVar(&dumpOptions.TemporalOptions.ExcludeColumns, "exclude-columns", "", "List of comma separated columns to exclude from the dump. Each column should have the database and table name included, for example \"mydb.mytable.mycolumn\". Generated columns are always excluded.")
+	flag.StringVar(&dumpOptions.TemporalOptions.MaskingRulesFile, "masking-rules", "", "INI file with the masking rules to apply to the columns. Each section is a table \"database.table\" and each key a column with one of the rules: null, fixed:value, hash, email, phone, random-string.")
+	flag.StringVar(&dumpOptions.TemporalOptions.MaskingSalt, "masking-salt", "", "Salt used by the hash, email and phone masking rules.")
 
-	flag.Parse()
+	// A --mysql-password without a value asks for the password.
+	flag.CommandLine.Parse(utils.RewritePasswordPrompt(os.Args[1:], flag.CommandLine))
 
 	// Collect the flags that were assigned from the command line.
 	flag.Visit(func(f *flag.Flag) { flagSet[f.Name] = true })
+	utils.SetOptionAliases(flagSet)
+
+	// Set the flags from the GODUMP_* environment variables, the command line
+	// overrides them and they override the files.
+	for name, value := range utils.GetEnvironmentOptions(os.Environ()) {
+		if flagSet[name] {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			log.Warningf("Unknown option in the environment variable %s", utils.GetEnvironmentVariable(name))
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("Error setting the option %s from the environment variable %s: %s",
+				name, utils.GetEnvironmentVariable(name), err.Error())
+		}
+		flagSet[name] = true
+	}
+	utils.SetOptionAliases(flagSet)
 
 	// Parse the ini file.
 	if flagIniFile != "" {
 		utils.ParseIniFile(flagIniFile, dumpOptions, flagSet)
 	}
 
+	// Parse the config file, it overrides the ini file.
+	if flagConfigFile != "" {
+		if err := utils.ParseConfigFile(flagConfigFile, dumpOptions, flagSet); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+
+	// Parse the login path, it overrides the ini file.
+	if dumpOptions.TemporalOptions.LoginPath != "" {
+		utils.ParseLoginPath(dumpOptions.TemporalOptions.LoginPath, dumpOptions, flagSet)
+	}
+
+	// Parse the DSN, it overrides the ini file and the login path.
+	if dumpOptions.TemporalOptions.DSN != "" {
+		if err := utils.ParseDSN(dumpOptions.TemporalOptions.DSN, dumpOptions, flagSet); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+
 	flags := make(map[string]*flag.Flag)
 
 	flag.CommandLine.VisitAll(func(f *flag.Flag) {
@@ -178,11 +258,89 @@ func main() {
 		PrintUsage(flags)
 	}
 
+	// Parsed InsertMode options
+	switch dumpOptions.InsertMode {
+	case utils.InsertModeInsert, utils.InsertModeIgnore, utils.InsertModeReplace, utils.InsertModeUpdate:
+		log.Debugf("The insert mode is \"%s\".", dumpOptions.InsertMode)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --insert-mode.", dumpOptions.InsertMode)
+	}
+
+	// Parsed ChunkStrategy options
+	switch dumpOptions.ChunkStrategy {
+	case utils.ChunkStrategyOffset, utils.ChunkStrategyRange, utils.ChunkStrategyStatistics, utils.ChunkStrategySample:
+		log.Debugf("The chunk strategy is \"%s\".", dumpOptions.ChunkStrategy)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --chunk-strategy.", dumpOptions.ChunkStrategy)
+	}
+	if dumpOptions.ChunkThreads < 1 {
+		log.Fatal("The option --chunk-threads must be at least 1")
+	}
+	if dumpOptions.ChunkTargetTime < 0 {
+		log.Fatal("The option --chunk-target-time can't be negative")
+	}
+
+	// Parsed OutputLayout options
+	switch dumpOptions.OutputLayout {
+	case utils.OutputLayoutThread, utils.OutputLayoutChunk, utils.OutputLayoutDatabase, utils.OutputLayoutSingle:
+		log.Debugf("The output layout is \"%s\".", dumpOptions.OutputLayout)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --output-layout.", dumpOptions.OutputLayout)
+	}
+
+	// Parsed LockMode options
+	switch dumpOptions.LockMode {
+	case utils.LockModeAuto, utils.LockModeFTWRL, utils.LockModeLockTables, utils.LockModeBackupLocks:
+		log.Debugf("The lock mode is \"%s\".", dumpOptions.LockMode)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --lock-mode.", dumpOptions.LockMode)
+	}
+
+	// Parsed LongQueryAction options
+	switch dumpOptions.LongQueryAction {
+	case utils.LongQueryActionAbort, utils.LongQueryActionWait, utils.LongQueryActionKill:
+		log.Debugf("The long query action is \"%s\".", dumpOptions.LongQueryAction)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --long-query-action.", dumpOptions.LongQueryAction)
+	}
+
+	// Parsed the replication data options
+	switch dumpOptions.ReplicationDataFormat {
+	case utils.ReplicationDataFormatText, utils.ReplicationDataFormatSQL:
+		log.Debugf("The replication data format is \"%s\".", dumpOptions.ReplicationDataFormat)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --replication-data-format.", dumpOptions.ReplicationDataFormat)
+	}
+	switch dumpOptions.ReplicationSyntax {
+	case utils.ReplicationSyntaxAuto, utils.ReplicationSyntaxMaster, utils.ReplicationSyntaxSource:
+		log.Debugf("The replication syntax is \"%s\".", dumpOptions.ReplicationSyntax)
+	default:
+		log.Fatalf("Error: \"%s\" is not a valid option for --replication-syntax.", dumpOptions.ReplicationSyntax)
+	}
+
+	// Parsed the max file size
+	if maxFileSize, err := utils.ParseSize(dumpOptions.TemporalOptions.MaxFileSize); err != nil {
+		log.Fatalf("Error parsing --max-file-size: %s", err.Error())
+	} else {
+		dumpOptions.MaxFileSize = maxFileSize
+	}
+
+	// Parsed the chunk target size
+	if chunkTargetSize, err := utils.ParseSize(dumpOptions.TemporalOptions.ChunkTargetSize); err != nil {
+		log.Fatalf("Error parsing --chunk-target-size: %s", err.Error())
+	} else {
+		dumpOptions.ChunkTargetSize = chunkTargetSize
+	}
+
 	// Making sure that if LockTables is false, consistent must be false as well.
 	if !dumpOptions.LockTables && dumpOptions.Consistent {
 		log.Fatalf("Lock tables is required to get a consitent backup. Use --help for more information.")
 	}
 
+	if dumpOptions.NoData && dumpOptions.NoCreateInfo {
+		log.Fatal("Options --no-data and --no-create-info are mutually exclusive, there is nothing to dump.")
+	}
+
 	if dumpOptions.DestinationDir == "" {
 		log.Fatal("--destination dir is required, use --help for more information.")
 	}
@@ -217,6 +375,53 @@ func main() {
 		log.Fatal("The option --compress-level must be a number between 1 and 9")
 	}
 
+	// Parsed the columns to exclude.
+	if dumpOptions.TemporalOptions.ExcludeColumns != "" {
+		excludedColumns, err := utils.ColumnsFromString(dumpOptions.TemporalOptions.ExcludeColumns)
+		if err != nil {
+			log.Fatalf("Error parsing --exclude-columns: %s", err.Error())
+		}
+		dumpOptions.ExcludedColumns = excludedColumns
+	}
+
+	// Parsed the chunk keys.
+	if dumpOptions.TemporalOptions.ChunkKeys != "" {
+		if err := dumpOptions.SetChunkKeys(dumpOptions.TemporalOptions.ChunkKeys); err != nil {
+			log.Fatalf("Error parsing --chunk-keys: %s", err.Error())
+		}
+	}
+
+	// Parsed the session variables.
+	if dumpOptions.TemporalOptions.SessionVariables != "" {
+		sessionVariables, err := utils.SessionVariablesFromString(dumpOptions.TemporalOptions.SessionVariables)
+		if err != nil {
+			log.Fatalf("Error parsing --session-variables: %s", err.Error())
+		}
+		dumpOptions.SessionVariables = sessionVariables
+	}
+
+	// Parse the masking rules.
+	if dumpOptions.TemporalOptions.MaskingRulesFile != "" {
+		maskingRules, err := utils.ParseMaskingFile(
+			dumpOptions.TemporalOptions.MaskingRulesFile, dumpOptions.TemporalOptions.MaskingSalt)
+		if err != nil {
+			log.Fatalf("Error parsing the masking rules: %s", err.Error())
+		}
+		dumpOptions.MaskingRules = maskingRules
+		if dumpOptions.TemporalOptions.MaskingSalt == "" {
+			log.Warningf("The option --masking-salt is empty, the hashed values can be guessed from the original values.")
+		}
+	}
+
+	// Getting the password from the environment, a file or the terminal.
+	passwordProvider, err := utils.GetPasswordProvider(dumpOptions, flagSet)
+	if err != nil {
+		log.Fatalf("Error: %s", err.Error())
+	}
+	if err := dumpOptions.MySQLCredentials.ResolvePassword(passwordProvider); err != nil {
+		log.Fatalf("Error getting the MySQL password: %s", err.Error())
+	}
+
 	// Creating the buffer for the channel
 	cDataChunk := make(chan utils.DataChunk, dumpOptions.ChannelBufferSize)
 
@@ -235,17 +440,20 @@ func main() {
 		log.Critical("Error whith the database connection. %s", err.Error())
 	}
 	// Creating the Task Manager.
-	taskManager := utils.NewTaskManager(
+	taskManager, err := utils.NewTaskManager(
 		&wgCreateChunks,
 		&wgProcessChunks,
 		cDataChunk,
 		tmdb,
 		dumpOptions)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
 
 	// Making the lists of tables. Either from a database or the tables paramenter.
 	var tablesFromDatabases, tablesFromString, tablesToParse map[string]bool
 
-	dbchunks, err := utils.GetMySQLConnection(dumpOptions.MySQLHost, dumpOptions.MySQLCredentials)
+	dbchunks, err := utils.GetMySQLSessionConnection(dumpOptions.MySQLHost, dumpOptions.MySQLCredentials, taskManager.SessionVariables)
 
 	if err != nil {
 		log.Critical("Error whith the database connection. %s", err.Error())
@@ -284,6 +492,10 @@ func main() {
 	// Adding the utils to the task manager.
 	// We create one task per table
 	for table, _ := range tablesToParse {
+		if dumpOptions.GetTableOptions(table).Skip {
+			log.Infof("Skipping the table %s.", table)
+			continue
+		}
 		t := strings.Split(table, ".")
 		task := utils.NewTask(
 			t[0], t[1],
@@ -308,7 +520,9 @@ func main() {
 		log.Fatalf("Flags --dry-run and --execute are mutually exclusive")
 
 	}
-	go taskManager.PrintStatus()
+	if !dumpOptions.NoData {
+		go taskManager.PrintStatus()
+	}
 
 	if dumpOptions.TemporalOptions.DryRun {
 		go taskManager.CleanChunkChannel()
@@ -329,7 +543,14 @@ func main() {
 		taskManager.CreateChunksWaitGroup.Wait()
 		close(taskManager.ChunksChannel)
 		taskManager.ProcessChunksWaitGroup.Wait()
+		taskManager.ReleaseLocks()
 		taskManager.WriteTablesSQL(dumpOptions.AddDropTable)
+		if err := taskManager.CollateOutputFiles(); err != nil {
+			log.Fatalf("Error collating the output files: %s", err.Error())
+		}
+		if err := taskManager.WriteManifest(); err != nil {
+			log.Fatalf("Error writing the manifest: %s", err.Error())
+		}
 		log.Info("Waiting for the creation of all the chunks.")
 	}
 
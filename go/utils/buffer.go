@@ -22,19 +22,35 @@ type BufferOptions struct {
 	CompressLevel int
 	Type          string
 	Path          string
+	MaxFileSize   uint64
 }
 
 // Buffer is the default struct to write the data.
 type Buffer struct {
 	Type           string
+	Path           string
+	Files          []string
 	Buffer         *bufio.Writer
 	GzipWriter     *gzip.Writer
 	FileDescriptor *os.File
+	options        *BufferOptions
+	header         []byte
+	written        uint64
+	fileNumber     int
 }
 
 // Write a slice of bytes into the buffer.
 func (this *Buffer) Write(b []byte) (int, error) {
-	return this.Buffer.Write(b)
+	n, err := this.Buffer.Write(b)
+	this.written = this.written + uint64(n)
+	return n, err
+}
+
+// WriteHeader write the header of the file. The header is written again at
+// the beginning of each new file when the buffer is rotated.
+func (this *Buffer) WriteHeader(header string) {
+	this.header = []byte(header)
+	this.Write(this.header)
 }
 
 // Flush the buffer.
@@ -54,9 +70,47 @@ func (this *Buffer) Close() {
 	}
 }
 
+// NeedsRotation return true if the uncompressed bytes written in the current
+// file reached the max file size.
+func (this *Buffer) NeedsRotation() bool {
+	return this.options != nil && this.options.MaxFileSize > 0 &&
+		this.written >= this.options.MaxFileSize
+}
+
+// Rotate close the current file and continue writing in a new numbered file.
+// It must be called between two statements.
+func (this *Buffer) Rotate() {
+	this.Close()
+
+	this.fileNumber = this.fileNumber + 1
+	next := NewFileBuffer(GetRotatedFileName(this.options.Path, this.fileNumber),
+		this.options.Compress, this.options.CompressLevel)
+
+	this.Type = next.Type
+	this.Path = next.Path
+	this.Buffer = next.Buffer
+	this.GzipWriter = next.GzipWriter
+	this.FileDescriptor = next.FileDescriptor
+	this.Files = append(this.Files, next.Path)
+	this.written = 0
+
+	log.Debugf("Rotating to the file %s", this.Path)
+	this.Write(this.header)
+}
+
+// GetRotatedFileName return the name of the file number n of a rotated buffer,
+// for example "mydb.mytable-thread0.0001.sql".
+func GetRotatedFileName(fileName string, n int) string {
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s.%04d%s", strings.TrimSuffix(fileName, ext), n, ext)
+}
+
 func NewBuffer(options *BufferOptions) (*Buffer, error) {
 	if options.Type == BufferTypeFile {
-		return NewFileBuffer(options.Path, options.Compress, options.CompressLevel), nil
+		buffer := NewFileBuffer(options.Path, options.Compress, options.CompressLevel)
+		buffer.options = options
+		buffer.Files = []string{buffer.Path}
+		return buffer, nil
 	}
 	return nil, errors.New("Buffer type " + options.Type + " not susported.")
 }
@@ -79,16 +133,21 @@ func NewFileBuffer(fileName string, compress bool, compressLevel int) *Buffer {
 			log.Fatalf("Error getting gzip writer: %s", err.Error())
 		}
 		buffer := bufio.NewWriter(gzipWriter)
-		return &Buffer{Type: BufferTypeGzipFile, Buffer: buffer, GzipWriter: gzipWriter}
+		return &Buffer{Type: BufferTypeGzipFile, Path: fileName, Buffer: buffer,
+			GzipWriter: gzipWriter, FileDescriptor: fileDescriptor}
 	}
 	buffer := bufio.NewWriter(fileDescriptor)
-	return &Buffer{Type: BufferTypeFile, Buffer: buffer}
+	return &Buffer{Type: BufferTypeFile, Path: fileName, Buffer: buffer,
+		FileDescriptor: fileDescriptor}
 
 }
 
 func NewChunkBuffer(c *DataChunk, workerId int) (*Buffer, error) {
 
 	filename := fmt.Sprintf("%s-thread%d.sql", c.Task.Table.GetUnescapedFullName(), workerId)
+	if c.Task.TaskManager.OutputLayout == OutputLayoutChunk {
+		filename = fmt.Sprintf("%s.%05d.sql", c.Task.Table.GetUnescapedFullName(), c.Sequence)
+	}
 	fullpath := filepath.Join(c.Task.TaskManager.DestinationDir, filename)
 
 	bufferOptions := c.Task.TaskManager.GetBufferOptions()
@@ -99,12 +158,25 @@ func NewChunkBuffer(c *DataChunk, workerId int) (*Buffer, error) {
 		return nil, err
 	}
 
-	fmt.Fprintf(buffer, "SET NAMES utf8;\n")
-	fmt.Fprintf(buffer, "SET GLOBAL MAX_ALLOWED_PACKET=1073741824;\n")
-	fmt.Fprintf(buffer, "SET TIME_ZONE='+00:00';\n")
-	fmt.Fprintf(buffer, "SET UNIQUE_CHECKS=0;\n")
-	fmt.Fprintf(buffer, "SET FOREIGN_KEY_CHECKS=0;\n")
-	fmt.Fprintf(buffer, "SET SQL_MODE='NO_AUTO_VALUE_ON_ZERO';\n")
+	var header []string
+
+	// The collated files have their own header.
+	if !IsCollatedLayout(c.Task.TaskManager.OutputLayout) {
+		header = append(header,
+			"SET NAMES utf8mb4;\n",
+			"SET GLOBAL MAX_ALLOWED_PACKET=1073741824;\n",
+			"SET TIME_ZONE='+00:00';\n",
+			"SET UNIQUE_CHECKS=0;\n",
+			"SET FOREIGN_KEY_CHECKS=0;\n",
+			"SET SQL_MODE='NO_AUTO_VALUE_ON_ZERO';\n")
+	}
+
+	// The rotated files need the database as well.
+	if c.Task.TaskManager.MaxFileSize > 0 && !c.Task.TaskManager.SkipUseDatabase {
+		header = append(header, fmt.Sprintf("USE %s;\n", c.Task.Table.GetSchema()))
+	}
+
+	buffer.WriteHeader(strings.Join(header, ""))
 
 	return buffer, nil
 }
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetRotatedFileName(t *testing.T) {
+	names := []struct {
+		name   string
+		n      int
+		expect string
+	}{
+		{"/tmp/db.table-thread0.sql", 1, "/tmp/db.table-thread0.0001.sql"},
+		{"/tmp/db.table.00003.sql", 12, "/tmp/db.table.00003.0012.sql"},
+	}
+	for _, tt := range names {
+		if got := GetRotatedFileName(tt.name, tt.n); got != tt.expect {
+			t.Errorf("Got %s and expected %s", got, tt.expect)
+		}
+	}
+}
+
+func TestBufferRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-dump-buffer")
+	if err != nil {
+		t.Fatalf("Error creating the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	buffer, err := NewBuffer(&BufferOptions{
+		Type:        BufferTypeFile,
+		Path:        filepath.Join(dir, "db.table-thread0.sql"),
+		MaxFileSize: 25,
+	})
+	if err != nil {
+		t.Fatalf("Error creating the buffer: %s", err.Error())
+	}
+
+	buffer.WriteHeader("USE `db`;\n")
+	for _, statement := range []string{"INSERT 1;\n", "INSERT 2;\n", "INSERT 3;\n"} {
+		if buffer.NeedsRotation() {
+			buffer.Rotate()
+		}
+		buffer.Write([]byte(statement))
+	}
+	buffer.Close()
+
+	expect := map[string]string{
+		"db.table-thread0.sql":      "USE `db`;\nINSERT 1;\nINSERT 2;\n",
+		"db.table-thread0.0001.sql": "USE `db`;\nINSERT 3;\n",
+	}
+	if len(buffer.Files) != len(expect) {
+		t.Fatalf("Buffer has the files %v and we expect 2 files", buffer.Files)
+	}
+	for _, path := range buffer.Files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Error reading the file %s: %s", path, err.Error())
+		}
+		if string(content) != expect[filepath.Base(path)] {
+			t.Errorf("File %s has \"%s\" and we expect \"%s\"", path, content, expect[filepath.Base(path)])
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/outbrain/golib/log"
+)
+
+// Output layouts of the dump.
+const (
+	// OutputLayoutThread creates one file per table per thread.
+	OutputLayoutThread = "thread"
+	// OutputLayoutChunk creates one file per chunk.
+	OutputLayoutChunk = "chunk"
+	// OutputLayoutDatabase creates one SQL file per database.
+	OutputLayoutDatabase = "database"
+	// OutputLayoutSingle creates one SQL file for the whole dump.
+	OutputLayoutSingle = "single"
+)
+
+// SingleFileName is the name of the file with the OutputLayoutSingle layout.
+const SingleFileName = "dump.sql"
+
+// mysqldump compatible session variables written at the beginning and the end
+// of the collated files.
+const collatedFileHeader = `/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;
+/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;
+/*!50503 SET NAMES utf8mb4 */;
+/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
+/*!40103 SET TIME_ZONE='+00:00' */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;
+/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
+/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
+`
+
+const collatedFileFooter = `/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
+/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+`
+
+// IsCollatedLayout return true if the files of the tables are merged into
+// bigger files after the dump.
+func IsCollatedLayout(layout string) bool {
+	return layout == OutputLayoutDatabase || layout == OutputLayoutSingle
+}
+
+// addDefinitionFile store the file with the definition of a table.
+func (this *TaskManager) addDefinitionFile(table string, path string) {
+	this.outputFilesMutex.Lock()
+	defer this.outputFilesMutex.Unlock()
+
+	if this.definitionFiles == nil {
+		this.definitionFiles = make(map[string]string)
+	}
+	this.definitionFiles[table] = path
+}
+
+// addDataFiles store the files written by a buffer with the data of a table.
+// The files of a rotated buffer are stored in the order they were created.
+func (this *TaskManager) addDataFiles(table string, paths []string) {
+	this.outputFilesMutex.Lock()
+	defer this.outputFilesMutex.Unlock()
+
+	if this.dataFiles == nil {
+		this.dataFiles = make(map[string][][]string)
+	}
+	this.dataFiles[table] = append(this.dataFiles[table], paths)
+}
+
+// getTableFiles return the files of a table in the order to restore them,
+// the definition first and then the data files sorted by the name of the
+// first file of each buffer.
+func (this *TaskManager) getTableFiles(table string) []string {
+	this.outputFilesMutex.Lock()
+	defer this.outputFilesMutex.Unlock()
+
+	var files []string
+	if path, ok := this.definitionFiles[table]; ok {
+		files = append(files, path)
+	}
+	data := append([][]string{}, this.dataFiles[table]...)
+	sort.Slice(data, func(i, j int) bool {
+		return data[i][0] < data[j][0]
+	})
+	for _, paths := range data {
+		files = append(files, paths...)
+	}
+	return files
+}
+
+// getTasksBySchema return the tasks grouped by schema. The schemas and the
+// tasks are sorted by name.
+func (this *TaskManager) getTasksBySchema() ([]string, map[string][]*Task) {
+	var schemas []string
+	tasks := make(map[string][]*Task)
+
+	for _, task := range this.tasksPool {
+		schema := task.Table.GetUnescapedSchema()
+		if _, ok := tasks[schema]; !ok {
+			schemas = append(schemas, schema)
+		}
+		tasks[schema] = append(tasks[schema], task)
+	}
+
+	sort.Strings(schemas)
+	for _, schema := range schemas {
+		t := tasks[schema]
+		sort.Slice(t, func(i, j int) bool {
+			return t[i].Table.GetUnescapedName() < t[j].Table.GetUnescapedName()
+		})
+	}
+	return schemas, tasks
+}
+
+// CollateOutputFiles merge the definition and the data files of the tables in
+// one SQL file per database or in one file for the whole dump, depending on
+// the output layout. It must be called after the workers finished.
+func (this *TaskManager) CollateOutputFiles() error {
+	if !IsCollatedLayout(this.OutputLayout) {
+		return nil
+	}
+
+	schemas, tasks := this.getTasksBySchema()
+
+	var buffer *Buffer
+	var err error
+
+	for _, schema := range schemas {
+		if buffer == nil {
+			filename := SingleFileName
+			if this.OutputLayout == OutputLayoutDatabase {
+				filename = fmt.Sprintf("%s.sql", schema)
+			}
+			log.Infof("Collating the files in %s", filename)
+			if buffer, err = this.newCollatedBuffer(filename); err != nil {
+				return err
+			}
+			this.collatedFiles = append(this.collatedFiles, buffer.Path)
+		}
+
+		// Select the database of the tables. The single file needs it even
+		// with --skip-use-database because it has several databases.
+		if this.OutputLayout == OutputLayoutSingle || !this.SkipUseDatabase {
+			fmt.Fprintf(buffer, GetUseDatabaseSQL(tasks[schema][0].Table.GetSchema())+";\n")
+		}
+
+		for _, task := range tasks[schema] {
+			files := this.getTableFiles(task.Table.GetUnescapedFullName())
+			if err := this.copyFiles(buffer, files); err != nil {
+				return err
+			}
+		}
+
+		if this.OutputLayout == OutputLayoutDatabase {
+			this.closeCollatedBuffer(buffer)
+			buffer = nil
+		}
+	}
+
+	if buffer != nil {
+		this.closeCollatedBuffer(buffer)
+	}
+	return nil
+}
+
+func (this *TaskManager) newCollatedBuffer(filename string) (*Buffer, error) {
+	bufferOptions := this.GetBufferOptions()
+	bufferOptions.Path = filepath.Join(this.DestinationDir, filename)
+
+	buffer, err := NewBuffer(bufferOptions)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprint(buffer, collatedFileHeader)
+	return buffer, nil
+}
+
+func (this *TaskManager) closeCollatedBuffer(buffer *Buffer) {
+	fmt.Fprint(buffer, collatedFileFooter)
+	buffer.Close()
+}
+
+// copyFiles append the content of the files to the buffer and remove them.
+func (this *TaskManager) copyFiles(buffer *Buffer, files []string) error {
+	for _, path := range files {
+		fd, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("Error opening the file %s: %s", path, err.Error())
+		}
+
+		var reader io.Reader = fd
+		if this.Compress {
+			gzipReader, err := gzip.NewReader(fd)
+			if err != nil {
+				fd.Close()
+				return fmt.Errorf("Error reading the file %s: %s", path, err.Error())
+			}
+			reader = gzipReader
+		}
+
+		_, err = io.Copy(buffer, reader)
+		fd.Close()
+		if err != nil {
+			return fmt.Errorf("Error copying the file %s: %s", path, err.Error())
+		}
+
+		// The definitions are written with "SET NAMES binary".
+		fmt.Fprint(buffer, "/*!50503 SET NAMES utf8mb4 */;\n")
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("Error removing the file %s: %s", path, err.Error())
+		}
+	}
+	return nil
+}
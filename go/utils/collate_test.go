@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCollateOutputFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-dump-collate")
+	if err != nil {
+		t.Fatalf("Error creating the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	tm := &TaskManager{
+		DestinationDir:   dir,
+		OutputLayout:     OutputLayoutDatabase,
+		outputFilesMutex: new(sync.Mutex),
+	}
+	for _, table := range []*Table{
+		{schema: "db2", name: "t1"},
+		{schema: "db1", name: "t2"},
+		{schema: "db1", name: "t1"},
+	} {
+		tm.AddTask(&Task{Table: table, TaskManager: tm})
+	}
+
+	files := map[string]string{
+		"db1.t1-definition.sql": "CREATE db1.t1;\n",
+		"db1.t1-thread1.sql":    "INSERT db1.t1 thread1;\n",
+		"db1.t1-thread0.sql":    "INSERT db1.t1 thread0;\n",
+		"db1.t2-definition.sql": "CREATE db1.t2;\n",
+		"db2.t1-definition.sql": "CREATE db2.t1;\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing the file %s: %s", path, err.Error())
+		}
+		table := name[:strings.Index(name, "-")]
+		if strings.HasSuffix(name, "-definition.sql") {
+			tm.addDefinitionFile(table, path)
+		} else {
+			tm.addDataFiles(table, []string{path})
+		}
+	}
+
+	if err := tm.CollateOutputFiles(); err != nil {
+		t.Fatalf("Error collating the files: %s", err.Error())
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "db1.sql"))
+	if err != nil {
+		t.Fatalf("Error reading db1.sql: %s", err.Error())
+	}
+
+	var last int
+	for _, statement := range []string{"SET @OLD_CHARACTER_SET_CLIENT", "CREATE db1.t1;",
+		"INSERT db1.t1 thread0;", "INSERT db1.t1 thread1;", "CREATE db1.t2;", "SET SQL_NOTES=@OLD_SQL_NOTES"} {
+		i := strings.Index(string(content), statement)
+		if i < last {
+			t.Fatalf("Statement \"%s\" is not in the right position of db1.sql:\n%s", statement, content)
+		}
+		last = i
+	}
+	if strings.Contains(string(content), "db2") {
+		t.Fatalf("File db1.sql contains tables from db2")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "db2.sql")); err != nil {
+		t.Fatalf("File db2.sql was not created: %s", err.Error())
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("File %s was not removed", name)
+		}
+	}
+}
+
+func TestCollateSingleFileDatabases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-dump-collate")
+	if err != nil {
+		t.Fatalf("Error creating the temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	tm := &TaskManager{
+		DestinationDir:   dir,
+		OutputLayout:     OutputLayoutSingle,
+		SkipUseDatabase:  true,
+		outputFilesMutex: new(sync.Mutex),
+	}
+	for _, table := range []*Table{{schema: "db2", name: "t1"}, {schema: "db1", name: "t1"}} {
+		tm.AddTask(&Task{Table: table, TaskManager: tm})
+		path := filepath.Join(dir, table.GetUnescapedFullName()+"-thread0.sql")
+		content := "INSERT INTO `t1` VALUES (1);\n"
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing the file %s: %s", path, err.Error())
+		}
+		tm.addDataFiles(table.GetUnescapedFullName(), []string{path})
+	}
+
+	if err := tm.CollateOutputFiles(); err != nil {
+		t.Fatalf("Error collating the files: %s", err.Error())
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, SingleFileName))
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", SingleFileName, err.Error())
+	}
+
+	expected := "USE `db1`;\nINSERT INTO `t1` VALUES (1);\n/*!50503 SET NAMES utf8mb4 */;\n" +
+		"USE `db2`;\nINSERT INTO `t1` VALUES (1);\n/*!50503 SET NAMES utf8mb4 */;\n"
+	if !strings.Contains(string(content), expected) {
+		t.Fatalf("Each database should be selected before its tables:\n%s", content)
+	}
+}
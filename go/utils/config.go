@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configTableOptionsKey is the key of the configuration file with the options
+// of each table.
+const configTableOptionsKey = "table-options"
+
+// TableOptions are the options of a table that override the options of the
+// dump.
+type TableOptions struct {
+	// ChunkSize is the number of rows of each chunk of the table.
+	ChunkSize uint64 `yaml:"chunk-size"`
+	// Where is the condition of the rows to dump.
+	Where string `yaml:"where"`
+	// ChunkKey is the column used to split the table in chunks.
+	ChunkKey string `yaml:"chunk-key"`
+	// ChunkStrategy is the strategy to find the limits of the chunks.
+	ChunkStrategy string `yaml:"chunk-strategy"`
+	// Skip excludes the table from the dump.
+	Skip bool `yaml:"skip"`
+}
+
+// GetTableOptions return the options of a table ("database.table"). It
+// returns empty options if the table doesn't have any.
+func (this *DumpOptions) GetTableOptions(table string) *TableOptions {
+	if options, ok := this.TableOptions[table]; ok {
+		return options
+	}
+	return &TableOptions{}
+}
+
+// ParseConfigFile reads the options from a YAML file. The keys are the names
+// of the command line options and the options of the tables are in the
+// table-options key:
+//
+//	threads: 8
+//	databases: [sakila, employees]
+//	table-options:
+//	  sakila.rental:
+//	    chunk-size: 50000
+//	    where: "rental_date >= '2005-06-01'"
+//
+// The options of the command line are not overridden and the unknown options
+// are errors.
+func ParseConfigFile(configFile string, do *DumpOptions, flagSet map[string]bool) error {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read the config file %s: %s", configFile, err.Error())
+	}
+	return ParseConfig(content, do, flagSet)
+}
+
+// ParseConfig reads the options from the YAML content of a config file.
+func ParseConfig(content []byte, do *DumpOptions, flagSet map[string]bool) error {
+	var config yaml.MapSlice
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("Failed to parse the config file: %s", err.Error())
+	}
+
+	for _, item := range config {
+		name := fmt.Sprint(item.Key)
+		if name == configTableOptionsKey {
+			if err := parseConfigTableOptions(item.Value, do); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := getConfigValue(item.Value)
+		if err != nil {
+			return fmt.Errorf("Option %s: %s", name, err.Error())
+		}
+		if flagSet[name] {
+			continue
+		}
+		known, err := SetOption(name, value, do)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return fmt.Errorf("Unknown option %s in the config file", name)
+		}
+	}
+	return nil
+}
+
+// getConfigValue return the value of an option as string, the lists are
+// converted to comma separated values like in the command line.
+func getConfigValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case []interface{}, yaml.MapSlice:
+				return "", fmt.Errorf("The lists can only have values")
+			}
+			values[i] = fmt.Sprint(item)
+		}
+		return strings.Join(values, ","), nil
+	case yaml.MapSlice:
+		return "", fmt.Errorf("The value can't be a map")
+	}
+	return fmt.Sprint(value), nil
+}
+
+// parseConfigTableOptions set the options of the tables.
+func parseConfigTableOptions(value interface{}, do *DumpOptions) error {
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	tables := make(map[string]*TableOptions)
+	if err := yaml.UnmarshalStrict(content, &tables); err != nil {
+		return fmt.Errorf("Failed to parse the %s: %s", configTableOptionsKey, err.Error())
+	}
+
+	if do.TableOptions == nil {
+		do.TableOptions = make(map[string]*TableOptions)
+	}
+	for table, options := range tables {
+		if len(strings.Split(table, ".")) != 2 {
+			return fmt.Errorf("Invalid table \"%s\" in the %s, use \"database.table\"", table, configTableOptionsKey)
+		}
+		if options == nil {
+			options = &TableOptions{}
+		}
+		switch options.ChunkStrategy {
+		case "", ChunkStrategyOffset, ChunkStrategyRange, ChunkStrategyStatistics, ChunkStrategySample:
+		default:
+			return fmt.Errorf("Invalid chunk-strategy \"%s\" of the table %s", options.ChunkStrategy, table)
+		}
+		do.TableOptions[table] = options
+	}
+	return nil
+}
+
+// environmentPrefix is the prefix of the environment variables with options.
+const environmentPrefix = "GODUMP_"
+
+// GetEnvironmentOptions return the options set with environment variables,
+// indexed by the name of the command line option. The variable of an option
+// is its name in upper case with the prefix GODUMP_ and the dashes replaced by
+// underscores, for example GODUMP_MYSQL_USER for --mysql-user.
+func GetEnvironmentOptions(environ []string) map[string]string {
+	options := make(map[string]string)
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], environmentPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(parts[0], environmentPrefix)
+		if name == "" {
+			continue
+		}
+		options[strings.ToLower(strings.Replace(name, "_", "-", -1))] = parts[1]
+	}
+	return options
+}
+
+// GetEnvironmentVariable return the name of the environment variable of an
+// option.
+func GetEnvironmentVariable(option string) string {
+	return environmentPrefix + strings.ToUpper(strings.Replace(option, "-", "_", -1))
+}
+
+// SetChunkKeys set the columns used to split the tables from a list of comma
+// separated columns with the format "database.table.column". They override
+// the chunk keys of the config file.
+func (this *DumpOptions) SetChunkKeys(chunkKeys string) error {
+	columns, err := ColumnsFromString(chunkKeys)
+	if err != nil {
+		return err
+	}
+
+	if this.TableOptions == nil {
+		this.TableOptions = make(map[string]*TableOptions)
+	}
+	for table, column := range columns {
+		if len(column) != 1 {
+			return fmt.Errorf("The table %s has more than one chunk key", table)
+		}
+		options, ok := this.TableOptions[table]
+		if !ok {
+			options = &TableOptions{}
+			this.TableOptions[table] = options
+		}
+		options.ChunkKey = column[0]
+	}
+	return nil
+}
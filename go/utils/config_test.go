@@ -0,0 +1,108 @@
+package utils
+
+import "testing"
+
+func newConfigDumpOptions() *DumpOptions {
+	return &DumpOptions{MySQLHost: &MySQLHost{}, MySQLCredentials: &MySQLCredentials{}, Threads: 1}
+}
+
+func TestParseConfigFile(t *testing.T) {
+	do := newConfigDumpOptions()
+
+	if err := ParseConfigFile("../../test/config.yaml", do, map[string]bool{"threads": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if do.Threads == 3 {
+		t.Errorf("Threads shouldn't change.")
+	}
+	if do.ChunkSize != 20000 || do.ChannelBufferSize != 500 || do.MySQLCredentials.User != "testuser" {
+		t.Errorf("Unexpected options %+v", do)
+	}
+	if !do.GetSlaveStatus || !do.GetMasterStatus {
+		t.Errorf("The master and slave status should be true")
+	}
+	if do.TemporalOptions.Databases != "sakila,test" {
+		t.Errorf("Got databases %s", do.TemporalOptions.Databases)
+	}
+
+	rental := do.GetTableOptions("sakila.rental")
+	if rental.ChunkSize != 50000 || rental.Where != "rental_date >= '2005-06-01'" {
+		t.Errorf("Unexpected table options %+v", rental)
+	}
+	if !do.GetTableOptions("sakila.film_text").Skip || do.GetTableOptions("sakila.film").Skip {
+		t.Errorf("Only sakila.film_text should be skipped")
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	configs := []string{
+		"non-valid-option: true",
+		"threads: three",
+		"tables: {sakila: film}",
+		"table-options:\n  sakila.film:\n    chunk-sise: 10",
+		"table-options:\n  film:\n    skip: true",
+		"table-options:\n  sakila.film:\n    chunk-strategy: random",
+	}
+	for _, config := range configs {
+		if err := ParseConfig([]byte(config), newConfigDumpOptions(), map[string]bool{}); err == nil {
+			t.Errorf("Config \"%s\" should fail", config)
+		}
+	}
+}
+
+func TestGetEnvironmentOptions(t *testing.T) {
+	options := GetEnvironmentOptions([]string{
+		"HOME=/root",
+		"GODUMP_MYSQL_USER=backup",
+		"GODUMP_TABLES_WITHOUT_UNIQUEKEY=single-chunk",
+		"GODUMP_SESSION_VARIABLES=sql_mode='',net_write_timeout=7200",
+		"GODUMP_=ignored",
+	})
+	if len(options) != 3 || options["mysql-user"] != "backup" ||
+		options["tables-without-uniquekey"] != "single-chunk" ||
+		options["session-variables"] != "sql_mode='',net_write_timeout=7200" {
+		t.Errorf("Unexpected options %v", options)
+	}
+
+	if got := GetEnvironmentVariable("get-master-status"); got != "GODUMP_GET_MASTER_STATUS" {
+		t.Errorf("Got variable %s", got)
+	}
+}
+
+func TestSetChunkKeys(t *testing.T) {
+	do := newConfigDumpOptions()
+	do.TableOptions = map[string]*TableOptions{"sakila.rental": {ChunkKey: "rental_id", ChunkSize: 10}}
+
+	if err := do.SetChunkKeys("sakila.rental.customer_id,sakila.payment.payment_id"); err != nil {
+		t.Fatal(err)
+	}
+	rental := do.GetTableOptions("sakila.rental")
+	if rental.ChunkKey != "customer_id" || rental.ChunkSize != 10 {
+		t.Errorf("Unexpected options %+v", rental)
+	}
+	if do.GetTableOptions("sakila.payment").ChunkKey != "payment_id" {
+		t.Errorf("Missing the chunk key of sakila.payment")
+	}
+
+	if err := do.SetChunkKeys("sakila.rental.a,sakila.rental.b"); err == nil {
+		t.Errorf("Two chunk keys for a table should fail")
+	}
+}
+
+func TestSetOptionAliases(t *testing.T) {
+	do := newConfigDumpOptions()
+	do.GetMasterStatus = true
+	flagSet := map[string]bool{"get-source-status": true}
+	SetOptionAliases(flagSet)
+	if !flagSet["get-master-status"] || flagSet["get-slave-status"] {
+		t.Errorf("Unexpected options set %v", flagSet)
+	}
+
+	if err := ParseConfig([]byte("get-master-status: false"), do, flagSet); err != nil {
+		t.Fatal(err)
+	}
+	if !do.GetMasterStatus {
+		t.Errorf("The config file shouldn't override the alias of the command line")
+	}
+}
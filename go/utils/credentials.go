@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/term"
+)
+
+// PasswordProvider return the password of the MySQL user from a source other
+// than the command line, so the password is not visible in the processes list.
+type PasswordProvider interface {
+	GetPassword() (string, error)
+}
+
+// EnvPasswordProvider reads the password from an environment variable.
+type EnvPasswordProvider struct {
+	Variable string
+}
+
+// GetPassword return the value of the environment variable.
+func (this *EnvPasswordProvider) GetPassword() (string, error) {
+	password, ok := os.LookupEnv(this.Variable)
+	if !ok {
+		return "", fmt.Errorf("The environment variable %s is not defined", this.Variable)
+	}
+	return password, nil
+}
+
+// FilePasswordProvider reads the password from the first line of a file.
+type FilePasswordProvider struct {
+	Path string
+}
+
+// GetPassword return the first line of the file without the line break.
+func (this *FilePasswordProvider) GetPassword() (string, error) {
+	content, err := ioutil.ReadFile(this.Path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading the password file %s: %s", this.Path, err.Error())
+	}
+	password := strings.SplitN(string(content), "\n", 2)[0]
+	return strings.TrimSuffix(password, "\r"), nil
+}
+
+// PromptPasswordProvider asks for the password in the terminal. If the
+// standard input is not a terminal the password is read from its first line.
+type PromptPasswordProvider struct {
+	User string
+}
+
+// GetPassword ask for the password without echoing it.
+func (this *PromptPasswordProvider) GetPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("Error reading the password from the standard input: %s", err.Error())
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter password for %s: ", this.User)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("Error reading the password: %s", err.Error())
+	}
+	return string(password), nil
+}
+
+// GetPasswordProvider return the password provider selected in the options or
+// nil if the password is taken from --mysql-password or the ini file. The
+// providers of the command line win over --mysql-password and it wins over
+// the providers of the files.
+func GetPasswordProvider(do *DumpOptions, flagSet map[string]bool) (PasswordProvider, error) {
+	var providers, commandLine []PasswordProvider
+	add := func(option string, provider PasswordProvider) {
+		providers = append(providers, provider)
+		if flagSet[option] {
+			commandLine = append(commandLine, provider)
+		}
+	}
+
+	if do.TemporalOptions.PasswordPrompt {
+		add("mysql-password-prompt", &PromptPasswordProvider{User: do.MySQLCredentials.User})
+	}
+	if do.TemporalOptions.PasswordFile != "" {
+		add("mysql-password-file", &FilePasswordProvider{Path: do.TemporalOptions.PasswordFile})
+	}
+	if do.TemporalOptions.PasswordEnv != "" {
+		add("mysql-password-env", &EnvPasswordProvider{Variable: do.TemporalOptions.PasswordEnv})
+	}
+
+	if len(commandLine) > 0 {
+		providers = commandLine
+	} else if flagSet["mysql-password"] {
+		return nil, nil
+	}
+
+	switch len(providers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return providers[0], nil
+	}
+	return nil, fmt.Errorf("Options --mysql-password-prompt, --mysql-password-file and --mysql-password-env are mutually exclusive")
+}
+
+// ResolvePassword set the password of the credentials with the provider.
+func (this *MySQLCredentials) ResolvePassword(provider PasswordProvider) error {
+	if provider == nil {
+		return nil
+	}
+	password, err := provider.GetPassword()
+	if err != nil {
+		return err
+	}
+	this.Password = password
+	return nil
+}
+
+// RedactDSN return the DSN with the password replaced, so it can be logged.
+func RedactDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "<invalid DSN>"
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = "xxxxx"
+	}
+	return cfg.FormatDSN()
+}
+
+// RewritePasswordPrompt replace --mysql-password without a value by
+// --mysql-password-prompt in the command line arguments, so the password can
+// be asked like with the MySQL client. The password is the next argument
+// unless it is an option of the flags, so "--mysql-password -secret" still
+// uses "-secret" as password.
+func RewritePasswordPrompt(args []string, flags *flag.FlagSet) []string {
+	ret := make([]string, len(args))
+	copy(ret, args)
+	for i, arg := range ret {
+		if arg != "-mysql-password" && arg != "--mysql-password" {
+			continue
+		}
+		if i+1 == len(ret) || isFlagArgument(ret[i+1], flags) {
+			ret[i] = "--mysql-password-prompt"
+		}
+	}
+	return ret
+}
+
+// isFlagArgument return true if the argument is an option of the flags, the
+// help option or the "--" that ends the options.
+func isFlagArgument(arg string, flags *flag.FlagSet) bool {
+	if arg == "--" {
+		return true
+	}
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+	return name == "h" || name == "help" || flags.Lookup(name) != nil
+}
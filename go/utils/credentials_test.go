@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordProviders(t *testing.T) {
+	os.Setenv("GODUMP_TEST_PASSWORD", "envsecret")
+	defer os.Unsetenv("GODUMP_TEST_PASSWORD")
+
+	dir, err := ioutil.TempDir("", "go-dump-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	ioutil.WriteFile(passwordFile, []byte("filesecret\nignored\n"), 0600)
+
+	credentials := &MySQLCredentials{}
+	credentials.ResolvePassword(&EnvPasswordProvider{Variable: "GODUMP_TEST_PASSWORD"})
+	if credentials.Password != "envsecret" {
+		t.Errorf("Got password %s from the environment", credentials.Password)
+	}
+	credentials.ResolvePassword(&FilePasswordProvider{Path: passwordFile})
+	if credentials.Password != "filesecret" {
+		t.Errorf("Got password %s from the file", credentials.Password)
+	}
+
+	if err := credentials.ResolvePassword(&EnvPasswordProvider{Variable: "GODUMP_TEST_UNDEFINED"}); err == nil {
+		t.Errorf("Undefined environment variable should fail")
+	}
+
+	do := &DumpOptions{MySQLCredentials: credentials}
+	do.TemporalOptions.PasswordEnv = "GODUMP_TEST_PASSWORD"
+	do.TemporalOptions.PasswordFile = passwordFile
+	if _, err := GetPasswordProvider(do, map[string]bool{}); err == nil {
+		t.Errorf("Several password providers should fail")
+	}
+
+	// The providers of the command line win over the files, and
+	// --mysql-password over the providers of the files.
+	provider, err := GetPasswordProvider(do, map[string]bool{"mysql-password-env": true})
+	if _, ok := provider.(*EnvPasswordProvider); err != nil || !ok {
+		t.Errorf("The provider of the command line should be used: %v (%v)", provider, err)
+	}
+	do.TemporalOptions.PasswordEnv = ""
+	if provider, err := GetPasswordProvider(do, map[string]bool{"mysql-password": true}); err != nil || provider != nil {
+		t.Errorf("The password of the command line should be used: %v (%v)", provider, err)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	redacted := RedactDSN("root:secret@tcp(localhost:3306)/")
+	if strings.Contains(redacted, "secret") || !strings.Contains(redacted, "root:") {
+		t.Errorf("The password was not redacted: %s", redacted)
+	}
+}
+
+func TestRewritePasswordPrompt(t *testing.T) {
+	values := []struct {
+		args   []string
+		expect []string
+	}{
+		{[]string{"--mysql-password", "secret"}, []string{"--mysql-password", "secret"}},
+		{[]string{"--mysql-password", "--execute"}, []string{"--mysql-password-prompt", "--execute"}},
+		{[]string{"--execute", "-mysql-password"}, []string{"--execute", "--mysql-password-prompt"}},
+		{[]string{"--mysql-password=secret"}, []string{"--mysql-password=secret"}},
+		{[]string{"--mysql-password", "-secret"}, []string{"--mysql-password", "-secret"}},
+		{[]string{"--mysql-password", "--threads=2"}, []string{"--mysql-password-prompt", "--threads=2"}},
+		{[]string{"--mysql-password", "--"}, []string{"--mysql-password-prompt", "--"}},
+	}
+
+	flags := flag.NewFlagSet("go-dump", flag.ContinueOnError)
+	flags.Bool("execute", false, "")
+	flags.Int("threads", 1, "")
+	for _, tt := range values {
+		if got := RewritePasswordPrompt(tt.args, flags); !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("Arguments %v: got %v and expected %v", tt.args, got, tt.expect)
+		}
+	}
+}
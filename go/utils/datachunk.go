@@ -3,11 +3,19 @@ package utils
 import (
 	"database/sql"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/outbrain/golib/log"
 )
 
+// Insert modes to write the rows.
+const (
+	InsertModeInsert  = "insert"
+	InsertModeIgnore  = "ignore"
+	InsertModeReplace = "replace"
+	InsertModeUpdate  = "update"
+)
+
 // DataChunk is the structure to handle the information of each chunk
 type DataChunk struct {
 	Min           int64
@@ -16,18 +24,19 @@ type DataChunk struct {
 	Task          *Task
 	IsSingleChunk bool
 	IsLastChunk   bool
+	Rows          uint64 // Rows written by Parse
 }
 
 // GetWhereSQL return the where condition for a chunk
 func (this *DataChunk) GetWhereSQL() string {
 	if this.IsSingleChunk {
-		return ""
+		return this.Task.GetFilterSQL("WHERE")
 	}
 
 	if this.IsLastChunk {
-		return fmt.Sprintf(" WHERE %s >= ?", this.Task.Table.GetPrimaryOrUniqueKey())
+		return fmt.Sprintf(" WHERE %s >= ?%s", this.Task.Table.GetPrimaryOrUniqueKey(), this.Task.GetFilterSQL("AND"))
 	} else {
-		return fmt.Sprintf(" WHERE %s BETWEEN ? AND ?", this.Task.Table.GetPrimaryOrUniqueKey())
+		return fmt.Sprintf(" WHERE %s BETWEEN ? AND ?%s", this.Task.Table.GetPrimaryOrUniqueKey(), this.Task.GetFilterSQL("AND"))
 	}
 }
 
@@ -41,9 +50,40 @@ func (this *DataChunk) GetOrderBYSQL() string {
 
 func (this *DataChunk) GetPrepareSQL() string {
 
-	return fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ * FROM %s%s%s",
-		this.Task.Table.GetFullName(), this.GetWhereSQL(), this.GetOrderBYSQL())
+	return fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ %s FROM %s%s%s",
+		this.Task.Table.GetColumnsSQL(), this.Task.Table.GetFullName(),
+		this.GetWhereSQL(), this.GetOrderBYSQL())
+
+}
 
+// GetInsertSQL return the beginning of the statement to insert the rows
+// depending on the insert mode of the TaskManager.
+func (this *DataChunk) GetInsertSQL(columns []string) string {
+	var statement string
+	switch this.Task.TaskManager.InsertMode {
+	case InsertModeIgnore:
+		statement = "INSERT IGNORE INTO"
+	case InsertModeReplace:
+		statement = "REPLACE INTO"
+	default:
+		statement = "INSERT INTO"
+	}
+	return fmt.Sprintf("%s %s (%s) VALUES ", statement,
+		this.Task.Table.GetName(), GetColumnsListSQL(columns))
+}
+
+// GetInsertSuffixSQL return the end of the insert statement. It is only used
+// by the insert mode "update" to update all the columns of the existing rows.
+func (this *DataChunk) GetInsertSuffixSQL(columns []string) string {
+	if this.Task.TaskManager.InsertMode != InsertModeUpdate {
+		return ""
+	}
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		c := GetColumnsListSQL([]string{column})
+		updates[i] = fmt.Sprintf("%s=VALUES(%s)", c, c)
+	}
+	return fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s", strings.Join(updates, ","))
 }
 
 func (this *DataChunk) GetSampleSQL() string {
@@ -80,11 +120,24 @@ func (this *DataChunk) Parse(stmt *sql.Stmt, buffer *Buffer) error {
 	}
 
 	columns, _ := rows.ColumnTypes()
+	formats := NewColumnFormats(columns, this.Task.TaskManager.HexBlob)
+	columnNames := GetColumnsNames(formats)
 	buff := make([]interface{}, len(columns))
 	data := make([]interface{}, len(columns))
 	for i, _ := range buff {
 		buff[i] = &data[i]
 	}
+	maskingRules := this.Task.TaskManager.MaskingRules.GetColumnsRules(
+		this.Task.Table.GetUnescapedFullName(), columnNames)
+	for i, rule := range maskingRules {
+		if rule == nil {
+			continue
+		}
+		formats[i].Length = this.Task.Table.GetColumnLength(formats[i].Name)
+		if err := rule.CheckColumn(formats[i]); err != nil {
+			log.Fatalf("Masking rule of the table %s: %s", tablename, err.Error())
+		}
+	}
 	firstRow := true
 
 	//var rowsNumber = uint64(0)
@@ -98,7 +151,7 @@ func (this *DataChunk) Parse(stmt *sql.Stmt, buffer *Buffer) error {
 		*/
 
 		if firstRow {
-			fmt.Fprintf(buffer, "INSERT INTO %s VALUES \n(", this.Task.Table.GetName())
+			fmt.Fprintf(buffer, "%s\n(", this.GetInsertSQL(columnNames))
 		}
 		err = rows.Scan(buff...)
 
@@ -108,6 +161,7 @@ func (this *DataChunk) Parse(stmt *sql.Stmt, buffer *Buffer) error {
 		if err != nil {
 			fmt.Println("error:", err)
 		}
+		this.Rows++
 		if !firstRow {
 			fmt.Fprintf(buffer, "),\n(")
 		} else {
@@ -117,29 +171,27 @@ func (this *DataChunk) Parse(stmt *sql.Stmt, buffer *Buffer) error {
 		max := len(data)
 		for i, d := range data {
 
-			switch d.(type) {
-			case []byte:
-				buffer.Write([]byte("'"))
-				buffer.Write(ParseString(d))
-				buffer.Write([]byte("'"))
-			case int64:
-				fmt.Fprintf(buffer, "%d", d)
-			case nil:
-				buffer.Write([]byte("NULL"))
-			case time.Time:
-				fmt.Fprintf(buffer, "%s", d)
-			case float64:
-				fmt.Fprintf(buffer, "%g", d)
-			default:
-				buffer.Write(d.([]byte))
+			if maskingRules != nil && maskingRules[i] != nil {
+				d = maskingRules[i].Apply(d, formats[i])
 			}
+
+			buffer.Write(formats[i].Format(d))
 			if i != max-1 {
 				fmt.Fprintf(buffer, ",")
 			}
 		}
+
+		// Finish the statement to continue in a new file.
+		if buffer.NeedsRotation() {
+			fmt.Fprintf(buffer, ")%s;\n", this.GetInsertSuffixSQL(columnNames))
+			buffer.Rotate()
+			firstRow = true
+		}
 	}
 	rows.Close()
-	fmt.Fprintf(buffer, ");\n")
+	if !firstRow {
+		fmt.Fprintf(buffer, ")%s;\n", this.GetInsertSuffixSQL(columnNames))
+	}
 
 	return nil
 }
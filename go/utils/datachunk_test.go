@@ -48,3 +48,30 @@ func TestNewLastDataChunk(t *testing.T) {
 		}
 	}
 }
+
+func TestGetInsertSQL(t *testing.T) {
+	tm := &TaskManager{}
+	task := &Task{Table: table1, TaskManager: tm}
+	chunk := NewDataChunk(task)
+	columns := []string{"pk", "name"}
+
+	modes := []struct {
+		mode, insert, suffix string
+	}{
+		{InsertModeInsert, "INSERT INTO `table1` (`pk`,`name`) VALUES ", ""},
+		{InsertModeIgnore, "INSERT IGNORE INTO `table1` (`pk`,`name`) VALUES ", ""},
+		{InsertModeReplace, "REPLACE INTO `table1` (`pk`,`name`) VALUES ", ""},
+		{InsertModeUpdate, "INSERT INTO `table1` (`pk`,`name`) VALUES ",
+			" ON DUPLICATE KEY UPDATE `pk`=VALUES(`pk`),`name`=VALUES(`name`)"},
+	}
+
+	for _, tt := range modes {
+		tm.InsertMode = tt.mode
+		if chunk.GetInsertSQL(columns) != tt.insert {
+			t.Errorf("Got \"%s\" and expected \"%s\"", chunk.GetInsertSQL(columns), tt.insert)
+		}
+		if chunk.GetInsertSuffixSQL(columns) != tt.suffix {
+			t.Errorf("Got \"%s\" and expected \"%s\"", chunk.GetInsertSuffixSQL(columns), tt.suffix)
+		}
+	}
+}
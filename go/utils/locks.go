@@ -0,0 +1,355 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/outbrain/golib/log"
+)
+
+// Lock modes used to get a consistent backup.
+const (
+	// LockModeAuto uses the backup locks when the server supports them and
+	// FLUSH TABLES WITH READ LOCK or LOCK TABLES otherwise.
+	LockModeAuto = "auto"
+	// LockModeFTWRL always uses FLUSH TABLES WITH READ LOCK.
+	LockModeFTWRL = "ftwrl"
+	// LockModeLockTables always uses LOCK TABLES ... READ on the dumped tables.
+	LockModeLockTables = "lock-tables"
+	// LockModeBackupLocks requires the backup locks and fails without them.
+	LockModeBackupLocks = "backup-locks"
+)
+
+// Actions to take with the long running queries found before taking
+// FLUSH TABLES WITH READ LOCK.
+const (
+	// LongQueryActionAbort stops the dump.
+	LongQueryActionAbort = "abort"
+	// LongQueryActionWait waits for the queries to finish.
+	LongQueryActionWait = "wait"
+	// LongQueryActionKill kills the queries.
+	LongQueryActionKill = "kill"
+)
+
+// Backup locks available on the server.
+const (
+	backupLockNone = iota
+	// LOCK TABLES FOR BACKUP from Percona Server.
+	backupLockTables
+	// LOCK INSTANCE FOR BACKUP from MySQL 8.0.
+	backupLockInstance
+)
+
+// getConn return a dedicated connection from the pool. The locks belong to
+// a session so they must be taken and released in the same connection.
+func getConn(db *sql.DB) *sql.Conn {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		log.Fatalf("Error getting a connection: %s", err.Error())
+	}
+	return conn
+}
+
+// SupportsInstanceBackupLock return true if a server with this version
+// supports LOCK INSTANCE FOR BACKUP, this is MySQL 8.0 or newer.
+func SupportsInstanceBackupLock(version string) bool {
+	return !IsMariaDB(version) && VersionAtLeast(version, 8, 0, 0)
+}
+
+// takeBackupLock take the backup lock in its own connection and keep it until
+// the end of the dump with ReleaseLocks. The backup locks block the DDL and,
+// with Percona Server, the writes to the non transactional tables while the
+// transactional tables can still be written.
+func (this *TaskManager) takeBackupLock() {
+	if this.LockMode != LockModeAuto && this.LockMode != LockModeBackupLocks {
+		return
+	}
+
+	lockType := this.Server.BackupLockType()
+	if lockType == backupLockNone {
+		if this.LockMode == LockModeBackupLocks {
+			log.Fatalf("The server doesn't support backup locks. Use --lock-mode=auto to use FLUSH TABLES WITH READ LOCK or LOCK TABLES instead.")
+		}
+		log.Debugf("The server doesn't support backup locks.")
+		return
+	}
+
+	query := GetBackupLockSQL(lockType)
+	this.backupLockConn = getConn(this.DB)
+	if err := this.execLock(this.backupLockConn, query); err != nil {
+		this.backupLockConn.Close()
+		this.backupLockConn = nil
+		if this.LockMode == LockModeBackupLocks {
+			log.Fatalf("Error taking the backup lock: %s", err.Error())
+		}
+		log.Warningf("Error taking the backup lock, using the table locks instead: %s", err.Error())
+		return
+	}
+	log.Infof("Backup lock taken: %s", query)
+	this.backupLock = lockType
+
+	// Percona Server can clone the snapshot of the first worker so the writes
+	// to the transactional tables don't need to be blocked.
+	this.cloneSnapshot = lockType == backupLockTables
+}
+
+// useSnapshotMasterStatus return true if the master coordinates are read from
+// the cloned snapshot of the first worker. Without workers, like with
+// --no-data, they are read with the tables locked.
+func (this *TaskManager) useSnapshotMasterStatus() bool {
+	return this.cloneSnapshot && len(this.workersConn) > 0
+}
+
+// needsTablesLock return true if the writes must be blocked while the workers
+// start their transactions and the replication coordinates are collected.
+func (this *TaskManager) needsTablesLock() bool {
+	switch this.backupLock {
+	case backupLockTables:
+		// The slave coordinates are not part of the snapshot, and without
+		// workers there is no snapshot with the master coordinates.
+		return this.GetSlaveStatus || (this.GetMasterStatus && len(this.workersDB) == 0)
+	case backupLockInstance:
+		// One snapshot is consistent by itself, several snapshots, the
+		// replication coordinates or the non transactional tables need the
+		// writes blocked.
+		return len(this.workersDB) > 1 || this.GetMasterStatus || this.GetSlaveStatus ||
+			this.HasNonTransactionalTables()
+	}
+	return true
+}
+
+// useFTWRL return true if FLUSH TABLES WITH READ LOCK must be used instead of
+// LOCK TABLES to block the writes.
+func (this *TaskManager) useFTWRL(allDatabases bool) bool {
+	if !this.Server.SupportsFTWRL() {
+		if this.LockMode == LockModeFTWRL {
+			log.Fatalf("The server doesn't allow FLUSH TABLES WITH READ LOCK. Use --lock-mode=lock-tables instead.")
+		}
+		return false
+	}
+	switch this.LockMode {
+	case LockModeFTWRL:
+		return true
+	case LockModeLockTables:
+		return false
+	}
+	return allDatabases
+}
+
+// execLock run a lock statement. If the lock is not granted before the lock
+// wait timeout the statement is killed from another connection, otherwise it
+// would keep waiting in the server and block the writes behind it. If the
+// lock was granted while the statement was killed it is released before
+// returning the error.
+func (this *TaskManager) execLock(conn *sql.Conn, query string) error {
+	ctx := context.Background()
+	if this.LockWaitTimeout <= 0 {
+		_, err := conn.ExecContext(ctx, query)
+		return err
+	}
+
+	var connectionId int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connectionId); err != nil {
+		return err
+	}
+
+	var timedOut int32
+	killed := make(chan bool)
+	timer := time.AfterFunc(this.LockWaitTimeout, func() {
+		defer close(killed)
+		atomic.StoreInt32(&timedOut, 1)
+		log.Warningf("The lock was not granted after %s, killing the statement \"%s\".", this.LockWaitTimeout, query)
+		if _, err := this.DB.Exec(fmt.Sprintf("KILL QUERY %d", connectionId)); err != nil {
+			log.Errorf("Error killing the lock statement: %s", err.Error())
+		}
+	})
+	_, err := conn.ExecContext(ctx, query)
+	if !timer.Stop() {
+		// The KILL QUERY must not reach the statement that releases the lock.
+		<-killed
+	}
+	if atomic.LoadInt32(&timedOut) == 0 {
+		return err
+	}
+	if err == nil {
+		unlock := GetUnlockSQL(query)
+		log.Debugf("The lock was granted after the timeout, releasing it: %s", unlock)
+		if _, err := conn.ExecContext(ctx, unlock); err != nil {
+			log.Errorf("Error releasing the lock: %s", err.Error())
+		}
+	}
+	return fmt.Errorf("The lock was not granted after %s", this.LockWaitTimeout)
+}
+
+// GetUnlockSQL return the statement to release the lock taken with the lock
+// statement.
+func GetUnlockSQL(lockQuery string) string {
+	if strings.HasPrefix(lockQuery, GetBackupLockSQL(backupLockInstance)) {
+		return GetBackupUnlockSQL(backupLockInstance)
+	}
+	return "UNLOCK TABLES"
+}
+
+// LongQuery is a query found in the PROCESSLIST that runs for longer than
+// the long query guard.
+type LongQuery struct {
+	Id   int64
+	User string
+	Time int64
+	Info string
+}
+
+// getLongQueries return the queries running for longer than the long query
+// guard.
+func (this *TaskManager) getLongQueries() []*LongQuery {
+	rows, err := this.lockConn.QueryContext(context.Background(), GetLongQueriesSQL(this.LongQueryGuard))
+	if err != nil {
+		log.Fatalf("Error reading the PROCESSLIST: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var queries []*LongQuery
+	for rows.Next() {
+		q := new(LongQuery)
+		if err := rows.Scan(&q.Id, &q.User, &q.Time, &q.Info); err != nil {
+			log.Fatalf("Error reading the PROCESSLIST: %s", err.Error())
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// checkLongQueries look for long running queries before taking FLUSH TABLES
+// WITH READ LOCK. The lock waits for these queries and all the writes wait
+// for the lock, so depending on the long query action the dump is aborted,
+// waits for the queries or kills them.
+func (this *TaskManager) checkLongQueries() {
+	if this.LongQueryGuard <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(this.LongQueryWait)
+	for {
+		queries := this.getLongQueries()
+		if len(queries) == 0 {
+			return
+		}
+
+		for _, q := range queries {
+			log.Warningf("Long running query. Id: %d, User: %s, Time: %d, Query: %s", q.Id, q.User, q.Time, q.Info)
+		}
+
+		switch this.LongQueryAction {
+		case LongQueryActionKill:
+			for _, q := range queries {
+				log.Infof("Killing the query %d", q.Id)
+				if _, err := this.lockConn.ExecContext(context.Background(), fmt.Sprintf("KILL QUERY %d", q.Id)); err != nil {
+					log.Errorf("Error killing the query %d: %s", q.Id, err.Error())
+				}
+			}
+		case LongQueryActionWait:
+			log.Infof("Waiting for %d long running queries.", len(queries))
+		default:
+			this.ReleaseLocks()
+			log.Fatalf("There are %d queries running for more than %s. Use --long-query-action to wait for them or kill them.", len(queries), this.LongQueryGuard)
+		}
+
+		if time.Now().After(deadline) {
+			this.ReleaseLocks()
+			log.Fatalf("The long running queries didn't finish after %s.", this.LongQueryWait)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// GetLongQueriesSQL return the query to get the queries running for longer
+// than the threshold, without the replication and the sleeping threads.
+func GetLongQueriesSQL(threshold time.Duration) string {
+	return fmt.Sprintf(`SELECT ID, USER, TIME, LEFT(INFO, 200)
+		FROM information_schema.PROCESSLIST
+		WHERE INFO IS NOT NULL AND TIME >= %d AND ID <> CONNECTION_ID()
+		AND USER <> 'system user'
+		AND COMMAND NOT IN ('Sleep', 'Binlog Dump', 'Binlog Dump GTID', 'Daemon', 'Killed')`,
+		int64(threshold/time.Second))
+}
+
+// ReleaseLocks release the backup lock and close the connections used to take
+// the locks. It must be called after the workers finished.
+func (this *TaskManager) ReleaseLocks() {
+	if this.tablesUnlocked != nil {
+		<-this.tablesUnlocked
+		this.tablesUnlocked = nil
+	}
+	if this.backupLockConn != nil {
+		query := GetBackupUnlockSQL(this.backupLock)
+		log.Debugf("Releasing the backup lock: %s", query)
+		if _, err := this.backupLockConn.ExecContext(context.Background(), query); err != nil {
+			log.Errorf("Error releasing the backup lock: %s", err.Error())
+		}
+		this.backupLockConn.Close()
+		this.backupLockConn = nil
+		this.backupLock = backupLockNone
+	}
+	if this.lockConn != nil {
+		this.lockConn.Close()
+		this.lockConn = nil
+	}
+}
+
+// GetBackupLockSQL return the statement to take a backup lock.
+func GetBackupLockSQL(lockType int) string {
+	switch lockType {
+	case backupLockTables:
+		return "LOCK TABLES FOR BACKUP"
+	case backupLockInstance:
+		return "LOCK INSTANCE FOR BACKUP"
+	}
+	return ""
+}
+
+// GetBackupUnlockSQL return the statement to release a backup lock.
+func GetBackupUnlockSQL(lockType int) string {
+	switch lockType {
+	case backupLockTables:
+		return "UNLOCK TABLES"
+	case backupLockInstance:
+		return "UNLOCK INSTANCE"
+	}
+	return ""
+}
+
+// GetIsolationLevelSQL return the statement to set the isolation level of the
+// session.
+func GetIsolationLevelSQL(level sql.IsolationLevel) string {
+	name := "REPEATABLE READ"
+	switch level {
+	case sql.LevelSerializable:
+		name = "SERIALIZABLE"
+	case sql.LevelReadCommitted:
+		name = "READ COMMITTED"
+	case sql.LevelReadUncommitted:
+		name = "READ UNCOMMITTED"
+	}
+	return fmt.Sprintf("SET SESSION TRANSACTION ISOLATION LEVEL %s", name)
+}
+
+// GetStartTransactionSQL return the statement to start the transaction of a
+// worker. With REPEATABLE READ the read view is created when the transaction
+// starts instead of the first read, so all the workers started under the lock
+// see the same data.
+func GetStartTransactionSQL(level sql.IsolationLevel) string {
+	if level == sql.LevelRepeatableRead {
+		return "START TRANSACTION WITH CONSISTENT SNAPSHOT /*!50605 , READ ONLY */"
+	}
+	return "START TRANSACTION /*!50605 READ ONLY */"
+}
+
+// GetCloneSnapshotSQL return the statement to start a transaction with the
+// same snapshot of another session. Only available in Percona Server.
+func GetCloneSnapshotSQL(sessionId int64) string {
+	return fmt.Sprintf("START TRANSACTION WITH CONSISTENT SNAPSHOT FROM SESSION %d", sessionId)
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupportsInstanceBackupLock(t *testing.T) {
+	versions := map[string]bool{
+		"8.0.33":                 true,
+		"8.0.33-25":              true,
+		"8.4.0":                  true,
+		"9.1.0":                  true,
+		"5.7.42-log":             false,
+		"10.6.12-MariaDB-log":    false,
+		"11.4.2-MariaDB-ubu2204": false,
+		"":                       false,
+	}
+	for version, expect := range versions {
+		if got := SupportsInstanceBackupLock(version); got != expect {
+			t.Errorf("Version %s: got %t and expected %t", version, got, expect)
+		}
+	}
+}
+
+func TestGetStartTransactionSQL(t *testing.T) {
+	if got := GetStartTransactionSQL(sql.LevelRepeatableRead); got != "START TRANSACTION WITH CONSISTENT SNAPSHOT /*!50605 , READ ONLY */" {
+		t.Errorf("Unexpected statement for REPEATABLE READ: %s", got)
+	}
+	if got := GetStartTransactionSQL(sql.LevelReadCommitted); got != "START TRANSACTION /*!50605 READ ONLY */" {
+		t.Errorf("Unexpected statement for READ COMMITTED: %s", got)
+	}
+	if got := GetIsolationLevelSQL(sql.LevelReadUncommitted); got != "SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED" {
+		t.Errorf("Unexpected isolation level statement: %s", got)
+	}
+}
+
+func TestNeedsTablesLock(t *testing.T) {
+	tm := &TaskManager{workersDB: make([]*sql.DB, 4)}
+	if !tm.needsTablesLock() {
+		t.Error("The tables must be locked without backup locks")
+	}
+
+	tm.backupLock = backupLockTables
+	if tm.needsTablesLock() {
+		t.Error("The tables don't need to be locked when the snapshot is cloned")
+	}
+	tm.GetSlaveStatus = true
+	if !tm.needsTablesLock() {
+		t.Error("The tables must be locked to get the slave status")
+	}
+
+	tm = &TaskManager{workersDB: make([]*sql.DB, 1), backupLock: backupLockInstance}
+	if tm.needsTablesLock() {
+		t.Error("The tables don't need to be locked with only one worker")
+	}
+	tm.workersDB = make([]*sql.DB, 2)
+	if !tm.needsTablesLock() {
+		t.Error("The tables must be locked to start several snapshots")
+	}
+}
+
+func TestNoDataWithBackupLocks(t *testing.T) {
+	// With --no-data there are no workers and no snapshot to clone.
+	tm := &TaskManager{NoData: true, GetMasterStatus: true, backupLock: backupLockTables, cloneSnapshot: true}
+	if !tm.needsTablesLock() {
+		t.Error("The tables must be locked to get the master status without workers")
+	}
+	if tm.useSnapshotMasterStatus() {
+		t.Error("The master status can't be read from the snapshot without workers")
+	}
+
+	tm = &TaskManager{GetMasterStatus: true, backupLock: backupLockTables, cloneSnapshot: true,
+		workersDB: make([]*sql.DB, 2), workersConn: make([]*sql.Conn, 2)}
+	if tm.needsTablesLock() || !tm.useSnapshotMasterStatus() {
+		t.Error("The master status should be read from the cloned snapshot")
+	}
+}
+
+func TestGetLongQueriesSQL(t *testing.T) {
+	query := GetLongQueriesSQL(90 * time.Second)
+	if !strings.Contains(query, "TIME >= 90 ") {
+		t.Errorf("The threshold is not in the query: %s", query)
+	}
+	if !strings.Contains(query, "ID <> CONNECTION_ID()") {
+		t.Errorf("The query must skip its own connection: %s", query)
+	}
+}
+
+func TestGetUnlockSQL(t *testing.T) {
+	queries := map[string]string{
+		"LOCK INSTANCE FOR BACKUP":          "UNLOCK INSTANCE",
+		"LOCK TABLES FOR BACKUP":            "UNLOCK TABLES",
+		"FLUSH TABLES WITH READ LOCK":       "UNLOCK TABLES",
+		"LOCK TABLES `sakila`.`actor` READ": "UNLOCK TABLES",
+	}
+	for query, expected := range queries {
+		if got := GetUnlockSQL(query); got != expected {
+			t.Errorf("%s: got %s and expected %s", query, got, expected)
+		}
+	}
+}
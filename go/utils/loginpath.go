@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/outbrain/golib/log"
+	ini "gopkg.in/ini.v1"
+)
+
+// The login path file written by mysql_config_editor starts with 4 unused
+// bytes and the 20 bytes used to build the AES key. Then each line of the ini
+// file is encrypted with AES-128-ECB and preceded by its length.
+const (
+	loginFileUnusedLength = 4
+	loginFileKeyLength    = 20
+)
+
+// GetLoginFilePath return the path of the login path file. Like the MySQL
+// client it can be changed with the MYSQL_TEST_LOGIN_FILE variable.
+func GetLoginFilePath() string {
+	if path := os.Getenv("MYSQL_TEST_LOGIN_FILE"); path != "" {
+		return path
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".mylogin.cnf")
+}
+
+// ReadLoginFile read and decrypt the login path file.
+func ReadLoginFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the login path file %s: %s", path, err.Error())
+	}
+	plain, err := DecryptLoginFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting the login path file %s: %s", path, err.Error())
+	}
+	return plain, nil
+}
+
+// DecryptLoginFile return the ini content of an obfuscated login path file.
+func DecryptLoginFile(data []byte) ([]byte, error) {
+	if len(data) < loginFileUnusedLength+loginFileKeyLength {
+		return nil, fmt.Errorf("The file is too short")
+	}
+
+	key := make([]byte, aes.BlockSize)
+	for i, b := range data[loginFileUnusedLength : loginFileUnusedLength+loginFileKeyLength] {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []byte
+	data = data[loginFileUnusedLength+loginFileKeyLength:]
+	for len(data) >= 4 {
+		length := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if length == 0 || length%aes.BlockSize != 0 || length > len(data) {
+			return nil, fmt.Errorf("Invalid length %d of an encrypted line", length)
+		}
+
+		line := make([]byte, length)
+		for i := 0; i < length; i += aes.BlockSize {
+			block.Decrypt(line[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+		data = data[length:]
+
+		// Remove the PKCS#7 padding.
+		padding := int(line[length-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("Invalid padding of an encrypted line")
+		}
+		plain = append(plain, line[:length-padding]...)
+	}
+	return plain, nil
+}
+
+// ParseLoginPath set the MySQL host and credentials from the [client] section
+// and the loginPath section of the login path file. These values override the
+// ini files but not the options of the command line.
+func ParseLoginPath(loginPath string, do *DumpOptions, flagSet map[string]bool) {
+	path := GetLoginFilePath()
+	content, err := ReadLoginFile(path)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+
+	cfg, err := ini.Load(content)
+	if err != nil {
+		log.Fatalf("Failed to parse the login path file %s: %s", path, err.Error())
+	}
+
+	if !cfg.HasSection(loginPath) {
+		log.Fatalf("The login path %s doesn't exist in %s", loginPath, path)
+	}
+	if loginPath != "client" && cfg.HasSection("client") {
+		parseMySQLIniOptions(cfg.Section("client"), do, flagSet)
+	}
+	parseMySQLIniOptions(cfg.Section(loginPath), do, flagSet)
+}
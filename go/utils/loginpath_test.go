@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encryptLoginFile obfuscate the lines like mysql_config_editor.
+func encryptLoginFile(t *testing.T, lines []string) []byte {
+	keyBytes := []byte("0123456789abcdefghij")
+	key := make([]byte, aes.BlockSize)
+	for i, b := range keyBytes {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	buf.Write(keyBytes)
+	for _, line := range lines {
+		padding := aes.BlockSize - len(line)%aes.BlockSize
+		plain := append([]byte(line), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		encrypted := make([]byte, len(plain))
+		for i := 0; i < len(plain); i += aes.BlockSize {
+			block.Encrypt(encrypted[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(len(encrypted)))
+		buf.Write(encrypted)
+	}
+	return buf.Bytes()
+}
+
+func TestDecryptLoginFile(t *testing.T) {
+	lines := []string{"[client]\n", "user = \"backup\"\n", "password = \"a long secret password\"\n"}
+	plain, err := DecryptLoginFile(encryptLoginFile(t, lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != strings.Join(lines, "") {
+		t.Errorf("Unexpected content: %q", plain)
+	}
+
+	if _, err := DecryptLoginFile([]byte("short")); err == nil {
+		t.Error("A short file should fail")
+	}
+}
+
+func TestParseLoginPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-dump-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loginFile := filepath.Join(dir, ".mylogin.cnf")
+	content := encryptLoginFile(t, []string{
+		"[client]\n", "user = \"client\"\n", "password = \"clientsecret\"\n",
+		"[backup]\n", "user = \"backup\"\n", "host = \"db1\"\n", "port = 3307\n",
+	})
+	ioutil.WriteFile(loginFile, content, 0600)
+	os.Setenv("MYSQL_TEST_LOGIN_FILE", loginFile)
+	defer os.Unsetenv("MYSQL_TEST_LOGIN_FILE")
+
+	do := &DumpOptions{MySQLHost: &MySQLHost{}, MySQLCredentials: &MySQLCredentials{}}
+	ParseLoginPath("backup", do, map[string]bool{"mysql-port": true})
+
+	if do.MySQLCredentials.User != "backup" || do.MySQLCredentials.Password != "clientsecret" {
+		t.Errorf("Unexpected credentials %+v", do.MySQLCredentials)
+	}
+	if do.MySQLHost.HostName != "db1" || do.MySQLHost.Port != 0 {
+		t.Errorf("Unexpected host %+v", do.MySQLHost)
+	}
+}
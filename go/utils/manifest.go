@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// ManifestFileName is the name of the file with the description of the dump.
+const ManifestFileName = "manifest.json"
+
+// Manifest describes the files of the dump. The files are listed in the order
+// to restore them.
+type Manifest struct {
+	Server *ServerInfo      `json:"server,omitempty"`
+	Layout string           `json:"layout"`
+	Files  []string         `json:"files"`
+	Tables []*ManifestTable `json:"tables"`
+}
+
+// Consistency of the data of a table in the manifest.
+const (
+	// ConsistencySnapshot means the rows were read from the consistent
+	// snapshot shared by all the workers.
+	ConsistencySnapshot = "snapshot"
+	// ConsistencyLocked means the table has no snapshots and the writes were
+	// blocked until it was dumped.
+	ConsistencyLocked = "locked"
+	// ConsistencyNone means the rows may not be consistent with the rest of
+	// the dump.
+	ConsistencyNone = "none"
+)
+
+// ManifestTable contains the files of a table in the order to restore them.
+// The files are empty if they were collated in bigger files.
+type ManifestTable struct {
+	Name        string   `json:"name"`
+	Engine      string   `json:"engine,omitempty"`
+	Consistency string   `json:"consistency,omitempty"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// GetManifest return the manifest of the dump. It must be called after the
+// output files were written.
+func (this *TaskManager) GetManifest() *Manifest {
+	manifest := &Manifest{
+		Server: this.Server,
+		Layout: this.OutputLayout,
+		Files:  []string{},
+		Tables: []*ManifestTable{},
+	}
+
+	schemas, tasks := this.getTasksBySchema()
+	for _, schema := range schemas {
+		for _, task := range tasks[schema] {
+			table := &ManifestTable{
+				Name:        task.Table.GetUnescapedFullName(),
+				Engine:      task.Table.Engine,
+				Consistency: this.getTableConsistency(task.Table),
+			}
+			if !IsCollatedLayout(this.OutputLayout) {
+				for _, path := range this.getTableFiles(table.Name) {
+					table.Files = append(table.Files, filepath.Base(path))
+				}
+				manifest.Files = append(manifest.Files, table.Files...)
+			}
+			manifest.Tables = append(manifest.Tables, table)
+		}
+	}
+
+	for _, path := range this.collatedFiles {
+		manifest.Files = append(manifest.Files, filepath.Base(path))
+	}
+	return manifest
+}
+
+// getTableConsistency return how the data of the table is consistent with the
+// rest of the dump. It is empty if the rows were not dumped.
+func (this *TaskManager) getTableConsistency(table *Table) string {
+	switch {
+	case this.NoData:
+		return ""
+	case table.IsTransactional() && this.snapshotConsistent:
+		return ConsistencySnapshot
+	case !table.IsTransactional() && this.nonTransactionalLocked:
+		return ConsistencyLocked
+	}
+	return ConsistencyNone
+}
+
+// WriteManifest write the manifest of the dump in the destination directory.
+func (this *TaskManager) WriteManifest() error {
+	content, err := json.MarshalIndent(this.GetManifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(this.DestinationDir, ManifestFileName),
+		append(content, '\n'), 0644)
+}
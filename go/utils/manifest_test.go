@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestGetManifest(t *testing.T) {
+	tm := &TaskManager{
+		DestinationDir:   "/tmp/testbackup",
+		OutputLayout:     OutputLayoutThread,
+		outputFilesMutex: new(sync.Mutex),
+	}
+	tm.AddTask(&Task{Table: &Table{schema: "db1", name: "t2"}, TaskManager: tm})
+	tm.AddTask(&Task{Table: &Table{schema: "db1", name: "t1"}, TaskManager: tm})
+
+	tm.addDefinitionFile("db1.t1", "/tmp/testbackup/db1.t1-definition.sql")
+	tm.addDataFiles("db1.t1", []string{"/tmp/testbackup/db1.t1-thread1.sql"})
+	tm.addDataFiles("db1.t1", []string{"/tmp/testbackup/db1.t1-thread0.sql",
+		"/tmp/testbackup/db1.t1-thread0.0001.sql"})
+	tm.addDefinitionFile("db1.t2", "/tmp/testbackup/db1.t2-definition.sql")
+
+	manifest := tm.GetManifest()
+
+	expect := []string{"db1.t1-definition.sql", "db1.t1-thread0.sql", "db1.t1-thread0.0001.sql",
+		"db1.t1-thread1.sql", "db1.t2-definition.sql"}
+	if !reflect.DeepEqual(manifest.Files, expect) {
+		t.Fatalf("Manifest files are %v and we expect %v", manifest.Files, expect)
+	}
+	if len(manifest.Tables) != 2 || manifest.Tables[0].Name != "db1.t1" || len(manifest.Tables[0].Files) != 4 {
+		t.Fatalf("Manifest tables are not the expected ones: %+v", manifest.Tables)
+	}
+}
+
+func TestGetTableConsistency(t *testing.T) {
+	innodb := &Table{Engine: "InnoDB"}
+	myisam := &Table{Engine: "MyISAM"}
+
+	tm := &TaskManager{snapshotConsistent: true, nonTransactionalLocked: true}
+	if got := tm.getTableConsistency(innodb); got != ConsistencySnapshot {
+		t.Errorf("InnoDB table consistency is %s", got)
+	}
+	if got := tm.getTableConsistency(myisam); got != ConsistencyLocked {
+		t.Errorf("MyISAM table consistency is %s", got)
+	}
+
+	tm.nonTransactionalLocked = false
+	if got := tm.getTableConsistency(myisam); got != ConsistencyNone {
+		t.Errorf("MyISAM table without lock consistency is %s", got)
+	}
+
+	tm.NoData = true
+	if got := tm.getTableConsistency(innodb); got != "" {
+		t.Errorf("The consistency must be empty without data, got %s", got)
+	}
+}
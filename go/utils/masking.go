@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	ini "gopkg.in/ini.v1"
+)
+
+// Transformations that can be applied to a masked column.
+const (
+	MaskNull         = "null"
+	MaskFixed        = "fixed"
+	MaskHash         = "hash"
+	MaskEmail        = "email"
+	MaskPhone        = "phone"
+	MaskRandomString = "random-string"
+)
+
+const maskRandomChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// maskHashLength is the number of hexadecimal characters of the hash of the
+// text values. Shorter hashes would repeat for different values and break the
+// unique keys and the joins.
+const maskHashLength = 16
+
+// MaskingRule is the transformation applied to the values of a column.
+type MaskingRule struct {
+	Type  string
+	Value string
+	salt  string
+}
+
+// MaskingRules contains the masking rules of the dump indexed by the
+// unescaped table name ("database.table") and the column name.
+type MaskingRules struct {
+	Salt   string
+	tables map[string]map[string]*MaskingRule
+}
+
+// NewMaskingRule parse a rule definition like "hash" or "fixed:value".
+func NewMaskingRule(definition string, salt string) (*MaskingRule, error) {
+	ruleType := definition
+	value := ""
+	if i := strings.Index(definition, ":"); i >= 0 {
+		ruleType = definition[:i]
+		value = definition[i+1:]
+	}
+
+	switch ruleType {
+	case MaskNull, MaskHash, MaskEmail, MaskPhone, MaskRandomString:
+		if value != "" {
+			return nil, fmt.Errorf("The masking rule %s doesn't accept a value", ruleType)
+		}
+	case MaskFixed:
+	default:
+		return nil, fmt.Errorf("Unknown masking rule \"%s\"", ruleType)
+	}
+
+	return &MaskingRule{Type: ruleType, Value: value, salt: salt}, nil
+}
+
+// ParseMaskingFile reads the masking rules from an ini file. Each section is
+// a table ("database.table") and each key is a column with the rule to apply.
+func ParseMaskingFile(rulesFile string, salt string) (*MaskingRules, error) {
+	cfg, err := ini.Load(rulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the masking rules file %s: %s", rulesFile, err.Error())
+	}
+
+	rules := &MaskingRules{Salt: salt, tables: make(map[string]map[string]*MaskingRule)}
+
+	for _, section := range cfg.Sections() {
+		if section.Name() == ini.DefaultSection {
+			if len(section.Keys()) > 0 {
+				return nil, fmt.Errorf("Masking rules must be inside a \"[database.table]\" section")
+			}
+			continue
+		}
+		if len(strings.Split(section.Name(), ".")) != 2 {
+			return nil, fmt.Errorf("Invalid table name \"%s\" in the masking rules, use \"database.table\"", section.Name())
+		}
+		for _, key := range section.Keys() {
+			rule, err := NewMaskingRule(key.Value(), salt)
+			if err != nil {
+				return nil, fmt.Errorf("Column %s.%s: %s", section.Name(), key.Name(), err.Error())
+			}
+			rules.AddRule(section.Name(), key.Name(), rule)
+		}
+	}
+	return rules, nil
+}
+
+// AddRule add a masking rule to a column of a table.
+func (this *MaskingRules) AddRule(table string, column string, rule *MaskingRule) {
+	if this.tables == nil {
+		this.tables = make(map[string]map[string]*MaskingRule)
+	}
+	if _, ok := this.tables[table]; !ok {
+		this.tables[table] = make(map[string]*MaskingRule)
+	}
+	this.tables[table][column] = rule
+}
+
+// GetColumnsRules return the rules for the columns of a table in the same
+// order of the columns. Columns without any rule have a nil value.
+func (this *MaskingRules) GetColumnsRules(table string, columns []string) []*MaskingRule {
+	if this == nil {
+		return nil
+	}
+
+	tableRules, ok := this.tables[table]
+	if !ok {
+		return nil
+	}
+
+	rules := make([]*MaskingRule, len(columns))
+	for i, column := range columns {
+		rules[i] = tableRules[column]
+	}
+	return rules
+}
+
+// CheckColumn return an error if the rule can't write a valid value in the
+// column. The numeric columns only accept the null, hash and fixed rules, and
+// the fixed value must be a number. The text columns must be wide enough for
+// the hash.
+func (this *MaskingRule) CheckColumn(format *ColumnFormat) error {
+	if !format.IsNumeric() {
+		if this.Type == MaskHash && format.Length > 0 && format.Length < maskHashLength {
+			return fmt.Errorf("The column %s can not hold the hash of the masking rule, it needs %d characters and it has %d",
+				format.Name, maskHashLength, format.Length)
+		}
+		return nil
+	}
+	switch this.Type {
+	case MaskNull, MaskHash:
+		return nil
+	case MaskFixed:
+		if isNumericLiteral([]byte(this.Value)) {
+			return nil
+		}
+		return fmt.Errorf("The fixed value \"%s\" is not a number and the column %s is %s",
+			this.Value, format.Name, format.TypeName)
+	}
+	return fmt.Errorf("The masking rule %s can not be used in the column %s, it is %s",
+		this.Type, format.Name, format.TypeName)
+}
+
+// Apply return the masked value of a column with the format. The hash, email
+// and phone rules are deterministic so the same value is always masked in the
+// same way and the masked columns can still be joined.
+func (this *MaskingRule) Apply(value interface{}, format *ColumnFormat) interface{} {
+	if this.Type == MaskNull {
+		return nil
+	}
+	if this.Type == MaskFixed {
+		return []byte(this.Value)
+	}
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+	switch v := value.(type) {
+	case int64, uint64:
+		b = []byte(fmt.Sprintf("%d", v))
+	case []byte:
+		b = v
+	default:
+		b = []byte(fmt.Sprintf("%v", v))
+	}
+
+	switch this.Type {
+	case MaskHash:
+		if format != nil && format.IsNumeric() {
+			return this.hashInt(b, format)
+		}
+		return this.hashString(b)
+	case MaskEmail:
+		return []byte(fmt.Sprintf("user%s@example.com", hex.EncodeToString(this.sum(b))[:12]))
+	case MaskPhone:
+		return this.phone(b)
+	case MaskRandomString:
+		return randomString(len(b))
+	}
+	return b
+}
+
+// sum return the HMAC-SHA256 of the value using the salt as key.
+func (this *MaskingRule) sum(b []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(this.salt))
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// hashString return the hexadecimal hash of the value with maskHashLength
+// characters.
+func (this *MaskingRule) hashString(b []byte) []byte {
+	return []byte(hex.EncodeToString(this.sum(b))[:maskHashLength])
+}
+
+// hashInt return an integer in the range of the numeric column, an uint64 if
+// the column is unsigned.
+func (this *MaskingRule) hashInt(b []byte, format *ColumnFormat) interface{} {
+	h := binary.BigEndian.Uint64(this.sum(b))
+	min, max := format.IntegerRange()
+	// The span overflows to 0 when the range is all the 64 bits.
+	if span := max - uint64(min) + 1; span != 0 {
+		h %= span
+	}
+	if format.IsUnsigned() {
+		return uint64(min) + h
+	}
+	return int64(uint64(min) + h)
+}
+
+// phone replace every digit of the value with a digit from the hash and
+// keep the rest of the characters, so the format is the same.
+func (this *MaskingRule) phone(b []byte) []byte {
+	sum := this.sum(b)
+	ret := make([]byte, len(b))
+	for i, c := range b {
+		if c >= '0' && c <= '9' {
+			c = '0' + sum[i%len(sum)]%10
+		}
+		ret[i] = c
+	}
+	return ret
+}
+
+func randomString(length int) []byte {
+	ret := make([]byte, length)
+	for i := range ret {
+		ret[i] = maskRandomChars[rand.Intn(len(maskRandomChars))]
+	}
+	return ret
+}
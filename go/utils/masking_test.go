@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+var textFormat = &ColumnFormat{Name: "name", TypeName: "VARCHAR"}
+
+func TestParseMaskingFile(t *testing.T) {
+	rules, err := ParseMaskingFile("../../test/masking.ini", "salt")
+	if err != nil {
+		t.Fatalf("Error parsing the masking file: %s", err.Error())
+	}
+
+	columnsRules := rules.GetColumnsRules("sakila.customer",
+		[]string{"customer_id", "first_name", "last_name", "email", "address_id"})
+
+	expected := []string{"", MaskHash, MaskFixed, MaskEmail, MaskNull}
+	for i, rule := range columnsRules {
+		if expected[i] == "" {
+			if rule != nil {
+				t.Errorf("Column %d shouldn't have any rule and it has %s", i, rule.Type)
+			}
+			continue
+		}
+		if rule == nil || rule.Type != expected[i] {
+			t.Errorf("Column %d should have the rule %s", i, expected[i])
+		}
+	}
+
+	if rules.GetColumnsRules("sakila.city", []string{"city_id"}) != nil {
+		t.Errorf("Table sakila.city shouldn't have any rule")
+	}
+}
+
+func TestNewMaskingRule(t *testing.T) {
+	for _, definition := range []string{"unknown", "hash:value", ""} {
+		if _, err := NewMaskingRule(definition, ""); err == nil {
+			t.Errorf("Rule \"%s\" should fail", definition)
+		}
+	}
+}
+
+func TestMaskingRuleApply(t *testing.T) {
+	rules := []struct {
+		definition string
+		value      interface{}
+		expect     interface{}
+	}{
+		{"null", []byte("secret"), nil},
+		{"fixed:Doe", []byte("Smith"), []byte("Doe")},
+		{"fixed:Doe", nil, []byte("Doe")},
+		{"hash", nil, nil},
+		{"email", nil, nil},
+	}
+
+	for _, tt := range rules {
+		rule, _ := NewMaskingRule(tt.definition, "salt")
+		got := rule.Apply(tt.value, textFormat)
+		if tt.expect == nil {
+			if got != nil {
+				t.Errorf("Rule %s: got %v and expected NULL", tt.definition, got)
+			}
+			continue
+		}
+		if !bytes.Equal(got.([]byte), tt.expect.([]byte)) {
+			t.Errorf("Rule %s: got %s and expected %s", tt.definition, got, tt.expect)
+		}
+	}
+}
+
+func TestMaskingRuleDeterministic(t *testing.T) {
+	for _, definition := range []string{"hash", "email", "phone"} {
+		rule, _ := NewMaskingRule(definition, "salt")
+		other, _ := NewMaskingRule(definition, "other salt")
+
+		first := rule.Apply([]byte("+1 (555) 123-4567"), textFormat)
+		second := rule.Apply([]byte("+1 (555) 123-4567"), textFormat)
+		if !bytes.Equal(first.([]byte), second.([]byte)) {
+			t.Errorf("Rule %s is not deterministic: %s and %s", definition, first, second)
+		}
+		if bytes.Equal(first.([]byte), other.Apply([]byte("+1 (555) 123-4567"), textFormat).([]byte)) {
+			t.Errorf("Rule %s doesn't use the salt", definition)
+		}
+	}
+
+	rule, _ := NewMaskingRule("hash", "salt")
+	intFormat := &ColumnFormat{Name: "id", TypeName: "INT"}
+	if rule.Apply(int64(10), intFormat) != rule.Apply(int64(10), intFormat) {
+		t.Errorf("Hash of integers is not deterministic")
+	}
+}
+
+func TestMaskingRuleKeepFormat(t *testing.T) {
+	phone, _ := NewMaskingRule("phone", "salt")
+	masked := phone.Apply([]byte("+1 (555) 123-4567"), textFormat).([]byte)
+	if len(masked) != 17 || masked[0] != '+' || masked[3] != '(' || masked[12] != '-' {
+		t.Errorf("Phone format is not the same: %s", masked)
+	}
+
+	random, _ := NewMaskingRule("random-string", "salt")
+	if len(random.Apply([]byte("secret"), textFormat).([]byte)) != 6 {
+		t.Errorf("Random string should keep the length")
+	}
+
+	hash, _ := NewMaskingRule("hash", "salt")
+	for _, value := range [][]byte{[]byte("abc"), bytes.Repeat([]byte("a"), 100)} {
+		if len(hash.Apply(value, textFormat).([]byte)) != maskHashLength {
+			t.Errorf("Hash of %d characters should have %d characters", len(value), maskHashLength)
+		}
+	}
+}
+
+func TestMaskingRuleHashShortValues(t *testing.T) {
+	hash, _ := NewMaskingRule("hash", "salt")
+	hashes := make(map[string]string)
+	for a := 'a'; a <= 'z'; a++ {
+		for b := 'a'; b <= 'z'; b++ {
+			value := string([]rune{a, b})
+			masked := string(hash.Apply([]byte(value), textFormat).([]byte))
+			if other, ok := hashes[masked]; ok {
+				t.Fatalf("The values %s and %s have the same hash %s", other, value, masked)
+			}
+			hashes[masked] = value
+		}
+	}
+}
+
+func TestMaskingRuleCheckColumn(t *testing.T) {
+	rules := []struct {
+		definition string
+		format     *ColumnFormat
+		valid      bool
+	}{
+		{"email", &ColumnFormat{Name: "email", TypeName: "VARCHAR"}, true},
+		{"hash", &ColumnFormat{Name: "code", TypeName: "CHAR", Length: 16}, true},
+		{"hash", &ColumnFormat{Name: "code", TypeName: "CHAR", Length: 2}, false},
+		{"fixed:US", &ColumnFormat{Name: "code", TypeName: "CHAR", Length: 2}, true},
+		{"hash", &ColumnFormat{Name: "id", TypeName: "INT"}, true},
+		{"null", &ColumnFormat{Name: "id", TypeName: "UNSIGNED BIGINT"}, true},
+		{"fixed:-1.5", &ColumnFormat{Name: "amount", TypeName: "DECIMAL"}, true},
+		{"fixed:Doe", &ColumnFormat{Name: "id", TypeName: "INT"}, false},
+		{"fixed:", &ColumnFormat{Name: "id", TypeName: "INT"}, false},
+		{"email", &ColumnFormat{Name: "id", TypeName: "INT"}, false},
+		{"random-string", &ColumnFormat{Name: "year", TypeName: "YEAR"}, false},
+	}
+
+	for _, tt := range rules {
+		rule, _ := NewMaskingRule(tt.definition, "salt")
+		if err := rule.CheckColumn(tt.format); (err == nil) != tt.valid {
+			t.Errorf("Rule %s on %s: got %v and expected valid %t", tt.definition, tt.format.TypeName, err, tt.valid)
+		}
+	}
+}
+
+func TestMaskingRuleHashInteger(t *testing.T) {
+	hash, _ := NewMaskingRule("hash", "salt")
+
+	formats := []struct {
+		format *ColumnFormat
+		min    int64
+		max    uint64
+	}{
+		{&ColumnFormat{TypeName: "TINYINT"}, -128, 127},
+		{&ColumnFormat{TypeName: "UNSIGNED TINYINT"}, 0, 255},
+		{&ColumnFormat{TypeName: "SMALLINT"}, -32768, 32767},
+		{&ColumnFormat{TypeName: "YEAR"}, 1901, 2155},
+		{&ColumnFormat{TypeName: "DECIMAL", Precision: 5, Scale: 2}, -999, 999},
+		{&ColumnFormat{TypeName: "UNSIGNED BIGINT"}, 0, 18446744073709551615},
+	}
+
+	negative := false
+	for _, tt := range formats {
+		for i := 0; i < 200; i++ {
+			var value int64
+			var ok bool
+			switch v := hash.Apply(int64(i), tt.format).(type) {
+			case int64:
+				value = v
+				ok = v >= tt.min && (v < 0 || uint64(v) <= tt.max)
+				negative = negative || v < 0
+			case uint64:
+				ok = tt.format.IsUnsigned() && v <= tt.max
+			}
+			if !ok {
+				t.Fatalf("%s: value %d out of the range %d..%d", tt.format.TypeName, value, tt.min, tt.max)
+			}
+		}
+	}
+	if !negative {
+		t.Errorf("Hash of the signed columns should return negative values")
+	}
+
+	tinyint := &ColumnFormat{TypeName: "TINYINT"}
+	if hash.Apply([]byte("10"), tinyint) != hash.Apply(int64(10), tinyint) {
+		t.Errorf("Hash of an integer should be the same as text and as number")
+	}
+}
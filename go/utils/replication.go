@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Formats of the master and slave data files.
+const (
+	// ReplicationDataFormatText writes the coordinates as text.
+	ReplicationDataFormatText = "text"
+	// ReplicationDataFormatSQL writes the statements to configure a replica.
+	ReplicationDataFormatSQL = "sql"
+)
+
+// Syntax of the statements to configure a replica.
+const (
+	// ReplicationSyntaxAuto uses CHANGE REPLICATION SOURCE TO if the server
+	// supports it and CHANGE MASTER TO otherwise.
+	ReplicationSyntaxAuto = "auto"
+	// ReplicationSyntaxMaster uses CHANGE MASTER TO.
+	ReplicationSyntaxMaster = "master"
+	// ReplicationSyntaxSource uses CHANGE REPLICATION SOURCE TO, available
+	// since MySQL 8.0.23.
+	ReplicationSyntaxSource = "source"
+)
+
+// ReplicationCoordinates contains the position of a source server to start
+// the replication of a replica restored from the dump.
+type ReplicationCoordinates struct {
+	Channel  string
+	Host     string
+	Port     uint64
+	File     string
+	Position uint64
+	// GtidSet is the executed GTID set of MySQL.
+	GtidSet string
+	// GtidPos is the GTID position of MariaDB.
+	GtidPos string
+	MariaDB bool
+}
+
+// ResolveReplicationSyntax return the syntax to use with a server version.
+// MariaDB only supports CHANGE MASTER TO.
+func ResolveReplicationSyntax(syntax string, version string) string {
+	if IsMariaDB(version) {
+		return ReplicationSyntaxMaster
+	}
+	if syntax == ReplicationSyntaxAuto {
+		if VersionAtLeast(version, 8, 0, 23) {
+			return ReplicationSyntaxSource
+		}
+		return ReplicationSyntaxMaster
+	}
+	return syntax
+}
+
+// IsLoopbackHost return true if the host is the local server, the replicas
+// can't use it to connect to the source.
+func IsLoopbackHost(host string) bool {
+	if host == "" || strings.ToLower(host) == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// HasGTID return true if the coordinates have a GTID position.
+func (this *ReplicationCoordinates) HasGTID() bool {
+	if this.MariaDB {
+		return this.GtidPos != ""
+	}
+	return this.GtidSet != ""
+}
+
+// GetGtidStateSQL return the statement to set the GTID state of the replica.
+// The GTID state is global, so it must be written once even with several
+// replication channels.
+func (this *ReplicationCoordinates) GetGtidStateSQL() string {
+	if this.MariaDB {
+		return fmt.Sprintf("SET GLOBAL gtid_slave_pos=%s;", quoteString(this.GtidPos))
+	}
+	// SHOW MASTER STATUS splits the GTID set in several lines.
+	gtidSet := strings.Replace(this.GtidSet, "\n", "", -1)
+	return fmt.Sprintf("SET @@GLOBAL.GTID_PURGED=%s;", quoteString(gtidSet))
+}
+
+// GetChangeSourceSQL return the CHANGE MASTER TO or CHANGE REPLICATION SOURCE
+// TO statement with the GTID auto position or the binary log coordinates.
+func (this *ReplicationCoordinates) GetChangeSourceSQL(syntax string, useGTID bool) string {
+	prefix := "MASTER_"
+	statement := "CHANGE MASTER TO"
+	if syntax == ReplicationSyntaxSource && !this.MariaDB {
+		prefix = "SOURCE_"
+		statement = "CHANGE REPLICATION SOURCE TO"
+	}
+	if this.MariaDB && this.Channel != "" {
+		statement = fmt.Sprintf("CHANGE MASTER %s TO", quoteString(this.Channel))
+	}
+
+	var options []string
+	if this.Host != "" {
+		options = append(options, fmt.Sprintf("%sHOST=%s", prefix, quoteString(this.Host)))
+	}
+	if this.Port != 0 {
+		options = append(options, fmt.Sprintf("%sPORT=%d", prefix, this.Port))
+	}
+
+	switch {
+	case useGTID && this.MariaDB:
+		options = append(options, "MASTER_USE_GTID=slave_pos")
+	case useGTID:
+		options = append(options, prefix+"AUTO_POSITION=1")
+	default:
+		options = append(options,
+			fmt.Sprintf("%sLOG_FILE=%s", prefix, quoteString(this.File)),
+			fmt.Sprintf("%sLOG_POS=%d", prefix, this.Position))
+	}
+
+	query := fmt.Sprintf("%s %s", statement, strings.Join(options, ", "))
+	if !this.MariaDB && this.Channel != "" {
+		query = fmt.Sprintf("%s FOR CHANNEL %s", query, quoteString(this.Channel))
+	}
+	return query + ";"
+}
+
+// GetSQL return the statements to configure a replica from these coordinates.
+// With useGTID the replica uses the GTID position when it is available and
+// the binary log coordinates are written as a comment, otherwise the binary
+// log coordinates are used. If setGtidState is false the GTID state is not
+// written because it was already written for another channel.
+func (this *ReplicationCoordinates) GetSQL(syntax string, useGTID bool, setGtidState bool) string {
+	var lines []string
+
+	if this.Channel != "" {
+		lines = append(lines, fmt.Sprintf("-- Channel: %s", this.Channel))
+	}
+
+	filePos := this.GetChangeSourceSQL(syntax, false)
+	if useGTID && this.HasGTID() {
+		if setGtidState {
+			lines = append(lines, this.GetGtidStateSQL())
+		}
+		lines = append(lines, this.GetChangeSourceSQL(syntax, true), "-- "+filePos)
+	} else {
+		lines = append(lines, filePos)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func quoteString(s string) string {
+	return string(quote(ParseString([]byte(s))))
+}
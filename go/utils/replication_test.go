@@ -0,0 +1,84 @@
+package utils
+
+import "testing"
+
+func TestResolveReplicationSyntax(t *testing.T) {
+	values := []struct {
+		syntax  string
+		version string
+		expect  string
+	}{
+		{ReplicationSyntaxAuto, "8.0.23", ReplicationSyntaxSource},
+		{ReplicationSyntaxAuto, "8.0.22-log", ReplicationSyntaxMaster},
+		{ReplicationSyntaxAuto, "5.7.42", ReplicationSyntaxMaster},
+		{ReplicationSyntaxAuto, "10.6.12-MariaDB", ReplicationSyntaxMaster},
+		{ReplicationSyntaxSource, "10.6.12-MariaDB", ReplicationSyntaxMaster},
+		{ReplicationSyntaxMaster, "8.4.0", ReplicationSyntaxMaster},
+	}
+	for _, tt := range values {
+		if got := ResolveReplicationSyntax(tt.syntax, tt.version); got != tt.expect {
+			t.Errorf("Syntax %s with version %s: got %s and expected %s", tt.syntax, tt.version, got, tt.expect)
+		}
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	for _, host := range []string{"", "localhost", "LOCALHOST", "127.0.0.1", "127.1.2.3", "::1", "[::1]"} {
+		if !IsLoopbackHost(host) {
+			t.Errorf("Host %s should be a loopback host", host)
+		}
+	}
+	for _, host := range []string{"db1", "10.0.0.5", "localhost.example.com", "::2"} {
+		if IsLoopbackHost(host) {
+			t.Errorf("Host %s shouldn't be a loopback host", host)
+		}
+	}
+}
+
+func TestReplicationCoordinatesSQL(t *testing.T) {
+	values := []struct {
+		coordinates *ReplicationCoordinates
+		syntax      string
+		useGTID     bool
+		expect      string
+	}{
+		{
+			&ReplicationCoordinates{Host: "db1", Port: 3306, File: "binlog.000008", Position: 154},
+			ReplicationSyntaxSource, true,
+			"CHANGE REPLICATION SOURCE TO SOURCE_HOST='db1', SOURCE_PORT=3306, SOURCE_LOG_FILE='binlog.000008', SOURCE_LOG_POS=154;\n",
+		},
+		{
+			&ReplicationCoordinates{File: "binlog.000008", Position: 154, GtidSet: "uuid:1-5,\nuuid2:1-3"},
+			ReplicationSyntaxMaster, true,
+			"SET @@GLOBAL.GTID_PURGED='uuid:1-5,uuid2:1-3';\n" +
+				"CHANGE MASTER TO MASTER_AUTO_POSITION=1;\n" +
+				"-- CHANGE MASTER TO MASTER_LOG_FILE='binlog.000008', MASTER_LOG_POS=154;\n",
+		},
+		{
+			&ReplicationCoordinates{File: "binlog.000008", Position: 154, GtidSet: "uuid:1-5"},
+			ReplicationSyntaxMaster, false,
+			"CHANGE MASTER TO MASTER_LOG_FILE='binlog.000008', MASTER_LOG_POS=154;\n",
+		},
+		{
+			&ReplicationCoordinates{Channel: "ch1", Host: "db1", Port: 3306, File: "binlog.000002", Position: 4, GtidSet: "uuid:1-5"},
+			ReplicationSyntaxSource, true,
+			"-- Channel: ch1\n" +
+				"SET @@GLOBAL.GTID_PURGED='uuid:1-5';\n" +
+				"CHANGE REPLICATION SOURCE TO SOURCE_HOST='db1', SOURCE_PORT=3306, SOURCE_AUTO_POSITION=1 FOR CHANNEL 'ch1';\n" +
+				"-- CHANGE REPLICATION SOURCE TO SOURCE_HOST='db1', SOURCE_PORT=3306, SOURCE_LOG_FILE='binlog.000002', SOURCE_LOG_POS=4 FOR CHANNEL 'ch1';\n",
+		},
+		{
+			&ReplicationCoordinates{Channel: "ch1", File: "mysql-bin.000003", Position: 328, GtidPos: "0-1-100", MariaDB: true},
+			ReplicationSyntaxSource, true,
+			"-- Channel: ch1\n" +
+				"SET GLOBAL gtid_slave_pos='0-1-100';\n" +
+				"CHANGE MASTER 'ch1' TO MASTER_USE_GTID=slave_pos;\n" +
+				"-- CHANGE MASTER 'ch1' TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=328;\n",
+		},
+	}
+	for i, tt := range values {
+		if got := tt.coordinates.GetSQL(tt.syntax, tt.useGTID, true); got != tt.expect {
+			t.Errorf("Coordinates %d: got\n%s\nand expected\n%s", i, got, tt.expect)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/outbrain/golib/log"
+)
+
+// Flavors of the server.
+const (
+	FlavorMySQL   = "mysql"
+	FlavorPercona = "percona"
+	FlavorMariaDB = "mariadb"
+	FlavorAurora  = "aurora"
+)
+
+// ServerInfo contains the flavor and the version of the server. The
+// TaskManager uses it to choose the locks and the statements to run.
+type ServerInfo struct {
+	Flavor         string `json:"flavor"`
+	Version        string `json:"version"`
+	VersionComment string `json:"version_comment,omitempty"`
+	// HaveBackupLocks is true if Percona Server supports LOCK TABLES FOR BACKUP.
+	HaveBackupLocks bool `json:"-"`
+}
+
+// GetServerInfo probe the server to get its flavor and version.
+func GetServerInfo(db *sql.DB) (*ServerInfo, error) {
+	server := new(ServerInfo)
+
+	err := db.QueryRow("SELECT @@version, @@version_comment").Scan(&server.Version, &server.VersionComment)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the server version: %s", err.Error())
+	}
+
+	// These variables only exist in some flavors, the errors are ignored.
+	var auroraVersion, haveBackupLocks string
+	db.QueryRow("SELECT @@aurora_version").Scan(&auroraVersion)
+	db.QueryRow("SELECT @@have_backup_locks").Scan(&haveBackupLocks)
+
+	server.Flavor = GetServerFlavor(server.Version, server.VersionComment, auroraVersion != "")
+	server.HaveBackupLocks = strings.ToUpper(haveBackupLocks) == "YES"
+
+	log.Infof("Server: %s %s (%s)", server.Flavor, server.Version, server.VersionComment)
+	return server, nil
+}
+
+// GetServerFlavor return the flavor of a server from its version and version
+// comment.
+func GetServerFlavor(version string, versionComment string, aurora bool) string {
+	switch {
+	case aurora:
+		return FlavorAurora
+	case IsMariaDB(version):
+		return FlavorMariaDB
+	case strings.Contains(strings.ToUpper(versionComment), "PERCONA"):
+		return FlavorPercona
+	}
+	return FlavorMySQL
+}
+
+// IsMariaDB return true if the server is MariaDB.
+func (this *ServerInfo) IsMariaDB() bool {
+	return this.Flavor == FlavorMariaDB
+}
+
+// BackupLockType return the backup lock supported by the server.
+func (this *ServerInfo) BackupLockType() int {
+	switch {
+	case this.Flavor == FlavorPercona && this.HaveBackupLocks:
+		return backupLockTables
+	case this.Flavor == FlavorAurora:
+		// Aurora doesn't allow the backup locks.
+		return backupLockNone
+	case SupportsInstanceBackupLock(this.Version):
+		return backupLockInstance
+	}
+	return backupLockNone
+}
+
+// SupportsFTWRL return true if the server allows FLUSH TABLES WITH READ LOCK.
+func (this *ServerInfo) SupportsFTWRL() bool {
+	return this.Flavor != FlavorAurora
+}
+
+// SupportsMultiSource return true if the replication status must be read with
+// SHOW ALL SLAVES STATUS to get all the connections.
+func (this *ServerInfo) SupportsMultiSource() bool {
+	return this.IsMariaDB()
+}
+
+// MasterStatusSQL return the statement to get the binary log coordinates.
+func (this *ServerInfo) MasterStatusSQL() string {
+	return GetMasterStatusSQL(this.Version)
+}
+
+// SlaveStatusSQL return the statement to get the status of the replication.
+func (this *ServerInfo) SlaveStatusSQL() string {
+	return GetSlaveStatusSQL(this.Version, this.SupportsMultiSource())
+}
+
+// ReplicationSyntax return the syntax of the replication statements.
+func (this *ServerInfo) ReplicationSyntax(syntax string) string {
+	return ResolveReplicationSyntax(syntax, this.Version)
+}
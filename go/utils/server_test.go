@@ -0,0 +1,44 @@
+package utils
+
+import "testing"
+
+func TestGetServerFlavor(t *testing.T) {
+	values := []struct {
+		version        string
+		versionComment string
+		aurora         bool
+		expect         string
+	}{
+		{"8.0.33", "MySQL Community Server - GPL", false, FlavorMySQL},
+		{"8.0.33-25", "Percona Server (GPL), Release 25, Revision 60c9e2c5", false, FlavorPercona},
+		{"10.6.12-MariaDB-log", "MariaDB Server", false, FlavorMariaDB},
+		{"8.0.28", "Source distribution", true, FlavorAurora},
+	}
+	for _, tt := range values {
+		if got := GetServerFlavor(tt.version, tt.versionComment, tt.aurora); got != tt.expect {
+			t.Errorf("Version %s (%s): got %s and expected %s", tt.version, tt.versionComment, got, tt.expect)
+		}
+	}
+}
+
+func TestServerInfoCapabilities(t *testing.T) {
+	values := []struct {
+		server     *ServerInfo
+		backupLock int
+		ftwrl      bool
+	}{
+		{&ServerInfo{Flavor: FlavorMySQL, Version: "5.7.42"}, backupLockNone, true},
+		{&ServerInfo{Flavor: FlavorMySQL, Version: "8.4.0"}, backupLockInstance, true},
+		{&ServerInfo{Flavor: FlavorPercona, Version: "5.7.42-45", HaveBackupLocks: true}, backupLockTables, true},
+		{&ServerInfo{Flavor: FlavorMariaDB, Version: "10.6.12-MariaDB"}, backupLockNone, true},
+		{&ServerInfo{Flavor: FlavorAurora, Version: "8.0.28"}, backupLockNone, false},
+	}
+	for _, tt := range values {
+		if got := tt.server.BackupLockType(); got != tt.backupLock {
+			t.Errorf("%s %s: backup lock %d and expected %d", tt.server.Flavor, tt.server.Version, got, tt.backupLock)
+		}
+		if got := tt.server.SupportsFTWRL(); got != tt.ftwrl {
+			t.Errorf("%s %s: FTWRL %t and expected %t", tt.server.Flavor, tt.server.Version, got, tt.ftwrl)
+		}
+	}
+}
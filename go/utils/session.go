@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/outbrain/golib/log"
+)
+
+// sessionCharset is the charset of the connections, the files are written
+// with "SET NAMES utf8mb4".
+const sessionCharset = "utf8mb4"
+
+// GetSessionVariables return the session variables of the connections that
+// read the data. The long dumps need longer timeouts than the defaults of the
+// server, and the temporal values are read in UTC like the files expect.
+// The variables override the defaults.
+func GetSessionVariables(server *ServerInfo, variables map[string]string) map[string]string {
+	session := map[string]string{
+		"time_zone":                "'+00:00'",
+		"net_read_timeout":         "3600",
+		"net_write_timeout":        "3600",
+		"wait_timeout":             "28800",
+		"innodb_lock_wait_timeout": "3600",
+	}
+
+	// The statements of the dump can't be killed by the server.
+	if server.IsMariaDB() {
+		if VersionAtLeast(server.Version, 10, 1, 1) {
+			session["max_statement_time"] = "0"
+		}
+	} else if VersionAtLeast(server.Version, 5, 7, 8) {
+		session["max_execution_time"] = "0"
+	}
+
+	for name, value := range variables {
+		session[name] = value
+	}
+	return session
+}
+
+// SessionVariablesFromString parse a list of comma separated variables with
+// the format "name=value". The commas inside quoted values are kept.
+func SessionVariablesFromString(variablesParam string) (map[string]string, error) {
+	ret := make(map[string]string)
+
+	for _, variable := range splitUnquoted(variablesParam, ',') {
+		if strings.TrimSpace(variable) == "" {
+			continue
+		}
+		parts := strings.SplitN(variable, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("Invalid session variable \"%s\", use \"name=value\"", variable)
+		}
+		ret[strings.ToLower(name)] = strings.TrimSpace(parts[1])
+	}
+	return ret, nil
+}
+
+// splitUnquoted split the string by the separator outside of the quotes.
+func splitUnquoted(s string, separator rune) []string {
+	var ret []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == separator:
+			ret = append(ret, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, s[start:])
+}
+
+// GetMySQLSessionConnection return a connection to the mysql server where
+// every connection of the pool sets the session variables and the charset.
+func GetMySQLSessionConnection(host *MySQLHost, credentials *MySQLCredentials, variables map[string]string) (*sql.DB, error) {
+	params := map[string]string{"charset": sessionCharset}
+	for name, value := range variables {
+		params[name] = value
+	}
+
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Debugf("Session variable: %s=%s", name, variables[name])
+	}
+
+	return getMySQLConnection(host, credentials, params)
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetSessionVariables(t *testing.T) {
+	session := GetSessionVariables(&ServerInfo{Flavor: FlavorMySQL, Version: "8.0.36"},
+		map[string]string{"net_write_timeout": "7200"})
+	if session["time_zone"] != "'+00:00'" || session["max_execution_time"] != "0" || session["net_write_timeout"] != "7200" {
+		t.Errorf("Unexpected MySQL session variables %v", session)
+	}
+
+	session = GetSessionVariables(&ServerInfo{Flavor: FlavorMariaDB, Version: "10.6.12-MariaDB"}, nil)
+	if _, ok := session["max_execution_time"]; ok || session["max_statement_time"] != "0" {
+		t.Errorf("Unexpected MariaDB session variables %v", session)
+	}
+
+	session = GetSessionVariables(&ServerInfo{Flavor: FlavorMySQL, Version: "5.6.51"}, nil)
+	if _, ok := session["max_execution_time"]; ok {
+		t.Errorf("MySQL 5.6 doesn't have max_execution_time")
+	}
+}
+
+func TestSessionVariablesFromString(t *testing.T) {
+	variables, err := SessionVariablesFromString("net_write_timeout=7200, SQL_MODE='ANSI_QUOTES,NO_ZERO_DATE'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 2 || variables["sql_mode"] != "'ANSI_QUOTES,NO_ZERO_DATE'" || variables["net_write_timeout"] != "7200" {
+		t.Errorf("Unexpected variables %v", variables)
+	}
+
+	if _, err := SessionVariablesFromString("net_write_timeout"); err == nil {
+		t.Errorf("A variable without a value should fail")
+	}
+}
+
+func TestGetMySQLDSNSession(t *testing.T) {
+	host := &MySQLHost{HostName: "db1", Port: 3306, SSLMode: SSLModeDisabled,
+		Params: map[string]string{"net_write_timeout": "60"}}
+	dsn, err := GetMySQLDSN(host, &MySQLCredentials{User: "backup"},
+		map[string]string{"time_zone": "'+00:00'", "net_write_timeout": "3600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(dsn, "?net_write_timeout=60&time_zone=%27%2B00%3A00%27") {
+		t.Errorf("Unexpected DSN %s", dsn)
+	}
+}
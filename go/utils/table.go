@@ -3,6 +3,7 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/outbrain/golib/log"
 )
@@ -15,6 +16,11 @@ type Table struct {
 	schema          string
 	primaryKey      []string
 	uniqueKey       []string
+	indexedKey      []string
+	nullableKeys    []string
+	columns         []string
+	excludedColumns []string
+	columnsLength   map[string]int64
 	keyForChunks    string
 	estNumberOfRows uint64
 	estDataSize     uint64
@@ -29,7 +35,7 @@ type Table struct {
 // getColumnsInformationSQL return the SQL statment to get the columns
 // information of a table
 func (this *Table) getColumnsInformationSQL() string {
-	return fmt.Sprintf(`SELECT COLUMN_NAME,COLUMN_KEY
+	return fmt.Sprintf(`SELECT COLUMN_NAME,COLUMN_KEY,IS_NULLABLE
 		FROM INFORMATION_SCHEMA.COLUMNS
 		WHERE TABLE_SCHEMA='%s' AND TABLE_NAME='%s'
 		  AND COLUMN_KEY IN ('PRI','UNI','MUL')
@@ -37,6 +43,15 @@ func (this *Table) getColumnsInformationSQL() string {
 			`, this.GetUnescapedSchema(), this.GetUnescapedName())
 }
 
+// getAllColumnsSQL return the SQL statment to get all the columns of a table
+// in the same order of the table definition.
+func (this *Table) getAllColumnsSQL() string {
+	return fmt.Sprintf(`SELECT COLUMN_NAME, EXTRA, CHARACTER_MAXIMUM_LENGTH
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA='%s' AND TABLE_NAME='%s'
+		ORDER BY ORDINAL_POSITION`, this.GetUnescapedSchema(), this.GetUnescapedName())
+}
+
 /*
 TABLE_CATALOG: def
 	TABLE_SCHEMA: panel_socialtools_dev
@@ -91,6 +106,61 @@ func (this *Table) GetUnescapedFullName() string {
 	return fmt.Sprintf("%s.%s", this.schema, this.name)
 }
 
+// GetColumnsSQL return the list of columns escaped to use in the SELECT
+// statement. It returns "*" if none of the columns were excluded.
+func (this *Table) GetColumnsSQL() string {
+	if len(this.excludedColumns) == 0 {
+		return "*"
+	}
+	return GetColumnsListSQL(this.columns)
+}
+
+// GetColumnLength return the maximum length of a text or binary column, 0 if
+// it is unknown.
+func (this *Table) GetColumnLength(column string) int64 {
+	return this.columnsLength[column]
+}
+
+// GetExcludedColumns return the columns that are not included in the dump.
+func (this *Table) GetExcludedColumns() []string {
+	return this.excludedColumns
+}
+
+// ExcludeColumns remove the columns from the dump. The names of the columns
+// are case insensitive like in MySQL. It returns an error if all the columns
+// were excluded.
+func (this *Table) ExcludeColumns(columns []string) error {
+	for _, column := range columns {
+		found := false
+		for i, c := range this.columns {
+			if strings.EqualFold(c, column) {
+				this.columns = append(this.columns[:i], this.columns[i+1:]...)
+				this.excludedColumns = append(this.excludedColumns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Warningf("Column %s doesn't exist in the table %s and can not be excluded.",
+				column, this.GetFullName())
+		}
+	}
+
+	if len(this.columns) == 0 {
+		return fmt.Errorf("All the columns of the table %s were excluded.", this.GetFullName())
+	}
+	return nil
+}
+
+// isGeneratedColumn return true if the EXTRA information of a column is from
+// a virtual or stored generated column. These columns can not be inserted.
+func isGeneratedColumn(extra string) bool {
+	extra = strings.ToUpper(extra)
+	return strings.Contains(extra, "VIRTUAL GENERATED") ||
+		strings.Contains(extra, "STORED GENERATED") ||
+		strings.Contains(extra, "PERSISTENT GENERATED")
+}
+
 // GetPrimaryOrUniqueKey return a string with the name of the unique or primary
 // key filed that we will use to split the table.
 // Empty string means that the table doens't have any primary or unique key to use.
@@ -113,6 +183,72 @@ func (this *Table) GetPrimaryOrUniqueKey() string {
 	return ""
 }
 
+// GetAverageRowLength return the estimated average size of the rows from the
+// statistics of the table, or 0 if the table doesn't have statistics.
+func (this *Table) GetAverageRowLength() uint64 {
+	if this.estNumberOfRows == 0 {
+		return 0
+	}
+	return this.estDataSize / this.estNumberOfRows
+}
+
+// GetChunkSizeForTarget return the number of rows of the chunks to read about
+// targetSize bytes in each chunk. It returns chunkSize if the table doesn't
+// have statistics.
+func (this *Table) GetChunkSizeForTarget(targetSize uint64, chunkSize uint64) uint64 {
+	averageRowLength := this.GetAverageRowLength()
+	if targetSize == 0 || averageRowLength == 0 {
+		return chunkSize
+	}
+	if rows := targetSize / averageRowLength; rows > 0 {
+		return rows
+	}
+	return 1
+}
+
+// SetKeyForChunks set the column used to split the table instead of the
+// primary or unique key. The column must be an indexed integer column without
+// NULL values, the rows with NULL are not in any chunk. The columns of a
+// primary key with several columns can't be used.
+func (this *Table) SetKeyForChunks(column string) error {
+	if containsString(this.nullableKeys, column) {
+		return fmt.Errorf("The column %s can not be used to split the table %s, it can have NULL values",
+			column, this.GetFullName())
+	}
+	keys := [][]string{this.uniqueKey, this.indexedKey}
+	if len(this.primaryKey) == 1 {
+		keys = append(keys, this.primaryKey)
+	}
+	for _, key := range keys {
+		if containsString(key, column) {
+			this.keyForChunks = column
+			return nil
+		}
+	}
+	return fmt.Errorf("The column %s can not be used to split the table %s, it must be an indexed integer column",
+		column, this.GetFullName())
+}
+
+// IsKeyForChunksUnique return true if the column used to split the table has
+// unique values. The non unique columns need more care to find the limits of
+// the chunks.
+func (this *Table) IsKeyForChunksUnique() bool {
+	key := this.GetPrimaryOrUniqueKey()
+	if len(this.primaryKey) == 1 && this.primaryKey[0] == key {
+		return true
+	}
+	return containsString(this.uniqueKey, key)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // getTableInformation collect and store the table information
 func (this *Table) getTableInformation(db *sql.DB) error {
 
@@ -131,6 +267,16 @@ func (this *Table) getTableInformation(db *sql.DB) error {
 	return err
 }
 
+// IsTransactional return true if the engine of the table has consistent
+// snapshots, so the rows can be read after the tables are unlocked.
+func (this *Table) IsTransactional() bool {
+	switch strings.ToUpper(this.Engine) {
+	case "INNODB", "TOKUDB", "ROCKSDB":
+		return true
+	}
+	return false
+}
+
 // getData collect the table information
 func (this *Table) getData(db *sql.DB) error {
 
@@ -142,19 +288,47 @@ func (this *Table) getData(db *sql.DB) error {
 		log.Fatal("Error getting column details for table ", this.GetFullName(), " : ", err.Error())
 	}
 
-	var cName, cKey string
+	var cName, cKey, cNullable, cExtra string
 
 	for rows.Next() {
-		rows.Scan(&cName, &cKey)
+		rows.Scan(&cName, &cKey, &cNullable)
 		switch cKey {
 		case "PRI":
 			this.primaryKey = append(this.primaryKey, cName)
 		case "UNI":
 			this.uniqueKey = append(this.uniqueKey, cName)
+		case "MUL":
+			this.indexedKey = append(this.indexedKey, cName)
 		default:
 
 		}
+		if cNullable == "YES" {
+			this.nullableKeys = append(this.nullableKeys, cName)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(this.getAllColumnsSQL())
+
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatal("Error getting columns for table ", this.GetFullName(), " : ", err.Error())
+	}
+
+	this.columnsLength = make(map[string]int64)
+	var cLength sql.NullInt64
+	for rows.Next() {
+		rows.Scan(&cName, &cExtra, &cLength)
+		if cLength.Valid {
+			this.columnsLength[cName] = cLength.Int64
+		}
+		if isGeneratedColumn(cExtra) {
+			log.Debugf("Skipping generated column %s on table %s", cName, this.GetFullName())
+			this.excludedColumns = append(this.excludedColumns, cName)
+			continue
+		}
+		this.columns = append(this.columns, cName)
 	}
+	rows.Close()
 	return nil
 }
 
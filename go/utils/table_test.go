@@ -57,3 +57,138 @@ func TestTable(t *testing.T) {
 	}
 
 }
+
+func TestTableExcludeColumns(t *testing.T) {
+	table := &Table{
+		name:       "table4",
+		schema:     "schema4",
+		primaryKey: []string{"pk"},
+		columns:    []string{"pk", "name", "picture"},
+	}
+
+	if table.GetColumnsSQL() != "*" {
+		t.Fatalf("Table columns are %s and we expect *.", table.GetColumnsSQL())
+	}
+
+	if err := table.ExcludeColumns([]string{"Picture", "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if table.GetColumnsSQL() != "`pk`,`name`" {
+		t.Fatalf("Table columns are %s and we expect `pk`,`name`.", table.GetColumnsSQL())
+	}
+	if len(table.GetExcludedColumns()) != 1 || table.GetExcludedColumns()[0] != "picture" {
+		t.Fatalf("Excluded columns are %v and we expect [picture].", table.GetExcludedColumns())
+	}
+
+	if err := table.ExcludeColumns([]string{"PK", "NAME"}); err == nil {
+		t.Fatalf("Excluding all the columns should fail")
+	}
+}
+
+func TestIsGeneratedColumn(t *testing.T) {
+	columns := []struct {
+		extra     string
+		generated bool
+	}{
+		{"", false},
+		{"auto_increment", false},
+		{"DEFAULT_GENERATED", false},
+		{"DEFAULT_GENERATED on update CURRENT_TIMESTAMP", false},
+		{"VIRTUAL GENERATED", true},
+		{"STORED GENERATED", true},
+		{"PERSISTENT GENERATED", true},
+	}
+
+	for _, tt := range columns {
+		if isGeneratedColumn(tt.extra) != tt.generated {
+			t.Errorf("Column with extra \"%s\" generated is %v and we expect %v.",
+				tt.extra, !tt.generated, tt.generated)
+		}
+	}
+}
+
+func TestTableIsTransactional(t *testing.T) {
+	engines := map[string]bool{
+		"InnoDB":     true,
+		"ROCKSDB":    true,
+		"MyISAM":     false,
+		"Aria":       false,
+		"MEMORY":     false,
+		"MRG_MYISAM": false,
+	}
+
+	for engine, transactional := range engines {
+		table := &Table{Engine: engine}
+		if table.IsTransactional() != transactional {
+			t.Errorf("Engine %s transactional is %v and we expect %v.",
+				engine, !transactional, transactional)
+		}
+	}
+}
+
+func TestTableSetKeyForChunks(t *testing.T) {
+	table := &Table{
+		name:         "rental",
+		schema:       "sakila",
+		primaryKey:   []string{"rental_id"},
+		indexedKey:   []string{"customer_id", "staff_id"},
+		nullableKeys: []string{"staff_id"},
+	}
+	if !table.IsKeyForChunksUnique() {
+		t.Errorf("The primary key is unique")
+	}
+
+	for _, column := range []string{"staff_id", "last_update"} {
+		if err := table.SetKeyForChunks(column); err == nil {
+			t.Errorf("The column %s can not be used to split the table", column)
+		}
+	}
+
+	if err := table.SetKeyForChunks("customer_id"); err != nil {
+		t.Fatal(err)
+	}
+	if table.GetPrimaryOrUniqueKey() != "customer_id" || table.IsKeyForChunksUnique() {
+		t.Errorf("The key for chunks should be the non unique customer_id")
+	}
+
+	task := &Task{Table: table, ChunkSize: 100, chunkMin: 51, chunkMax: 50}
+	expect := "SELECT customer_id FROM `sakila`.`rental` WHERE customer_id >= 51 ORDER BY customer_id LIMIT 1 OFFSET 100"
+	if got := task.GetChunkSqlQuery(); got != expect {
+		t.Errorf("Got \"%s\" and expected \"%s\"", got, expect)
+	}
+
+	composite := &Table{
+		name:       "film_actor",
+		schema:     "sakila",
+		primaryKey: []string{"actor_id", "film_id"},
+		indexedKey: []string{"film_id"},
+	}
+	for _, column := range []string{"actor_id", "last_update"} {
+		if err := composite.SetKeyForChunks(column); err == nil {
+			t.Errorf("The column %s of the composite primary key can not be used to split the table", column)
+		}
+	}
+	if err := composite.SetKeyForChunks("film_id"); err != nil {
+		t.Errorf("The indexed column film_id should split the table: %s", err.Error())
+	}
+}
+
+func TestTableGetChunkSizeForTarget(t *testing.T) {
+	values := []struct {
+		dataSize, rows, target, expect uint64
+	}{
+		{200000, 1000, 64 << 20, 335544},
+		{1 << 30, 1024, 64 << 20, 64},
+		{64 << 30, 16, 1 << 20, 1},
+		{0, 0, 64 << 20, 1000},
+		{200000, 1000, 0, 1000},
+	}
+	for _, tt := range values {
+		table := &Table{estDataSize: tt.dataSize, estNumberOfRows: tt.rows}
+		if got := table.GetChunkSizeForTarget(tt.target, 1000); got != tt.expect {
+			t.Errorf("Data size %d, rows %d and target %d: got %d and expected %d",
+				tt.dataSize, tt.rows, tt.target, got, tt.expect)
+		}
+	}
+}
@@ -1,12 +1,35 @@
 package utils
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/outbrain/golib/log"
 )
 
+// Strategies to find the limits of the chunks.
+const (
+	// ChunkStrategyOffset reads the key of the row at the offset of the chunk
+	// size, the chunks have the same number of rows.
+	ChunkStrategyOffset = "offset"
+	// ChunkStrategyRange splits the range between the minimum and the maximum
+	// of the key in steps of the chunk size. It only reads the limits of the
+	// key, the chunks have the same number of rows with dense keys like
+	// auto increment columns.
+	ChunkStrategyRange = "range"
+	// ChunkStrategyStatistics splits the key with the histogram of the column
+	// in the statistics of the server (MySQL 8.0 or newer). The chunks have
+	// about the same number of rows while the histogram is up to date.
+	ChunkStrategyStatistics = "statistics"
+	// ChunkStrategySample reads a random sample of the keys in a single query
+	// and starts a new chunk every few sampled keys.
+	ChunkStrategySample = "sample"
+)
+
 type Task struct {
 	Table           *Table
 	ChunkSize       uint64
@@ -15,27 +38,94 @@ type Task struct {
 	Tx              *sql.Tx
 	Id              int64
 	TotalChunks     uint64
+	Where           string
+	ChunkStrategy   string
 	chunkMin        int64
 	chunkMax        int64
+	initialSize     uint64
+	dumpedRows      uint64 // Updated with sync/atomic
+	dumpedTime      int64  // Updated with sync/atomic
 }
 
+// AddChunk queue a chunk of the task. The chunks of several tasks are created
+// at the same time so the counters of the task manager are atomic.
 func (this *Task) AddChunk(chunk DataChunk) {
-	this.TaskManager.AddChunk(chunk)
 	this.TotalChunks = this.TotalChunks + 1
-	this.TaskManager.TotalChunks = this.TaskManager.TotalChunks + 1
-	this.TaskManager.Queue = this.TaskManager.Queue + 1
+	atomic.AddInt64(&this.TaskManager.TotalChunks, 1)
+	queue := atomic.AddInt64(&this.TaskManager.Queue, 1)
+	this.TaskManager.AddChunk(chunk)
 	this.chunkMin = this.chunkMax + 1
-	log.Debugf("Queue +1: %d ", this.TaskManager.Queue)
+	log.Debugf("Queue +1: %d ", queue)
+}
+
+// AddChunkDuration add a chunk dumped by a worker to the rate used to resize
+// the next chunks of the task.
+func (this *Task) AddChunkDuration(rows uint64, elapsed time.Duration) {
+	atomic.AddUint64(&this.dumpedRows, rows)
+	atomic.AddInt64(&this.dumpedTime, int64(elapsed))
+}
+
+// GetChunkSizeForTime return the rows dumped in the target time with the rate
+// of the rows dumped in elapsed. The size is kept between a tenth and ten
+// times the initial size, and it is the initial size until a chunk with rows
+// is dumped.
+func GetChunkSizeForTime(rows uint64, elapsed, target time.Duration, initial uint64) uint64 {
+	if rows == 0 || elapsed <= 0 {
+		return initial
+	}
+	min, max := initial/10, initial*10
+	if min < 1 {
+		min = 1
+	}
+	size := float64(rows) * float64(target) / float64(elapsed)
+	switch {
+	case size < float64(min):
+		return min
+	case size > float64(max):
+		return max
+	}
+	return uint64(size)
+}
+
+// resizeChunk change the size of the next chunk with the time to dump the
+// previous chunks of the task.
+func (this *Task) resizeChunk() {
+	if this.TaskManager.ChunkTargetTime <= 0 {
+		return
+	}
+	size := GetChunkSizeForTime(atomic.LoadUint64(&this.dumpedRows),
+		time.Duration(atomic.LoadInt64(&this.dumpedTime)), this.TaskManager.ChunkTargetTime, this.initialSize)
+	if size != this.ChunkSize {
+		log.Debugf("Table %s: chunk size %d rows", this.Table.GetFullName(), size)
+		this.ChunkSize = size
+	}
+}
+
+// GetFilterSQL return the WHERE condition of the task joined with the
+// operator, or an empty string if all the rows are dumped.
+func (this *Task) GetFilterSQL(operator string) string {
+	if this.Where == "" {
+		return ""
+	}
+	return fmt.Sprintf(" %s (%s)", operator, this.Where)
 }
 
 func (this *Task) GetSingleChunkTestQuery() string {
-	return fmt.Sprintf("SELECT 1 FROM %s LIMIT 1 ", this.Table.GetFullName())
+	return fmt.Sprintf("SELECT 1 FROM %s%s LIMIT 1 ", this.Table.GetFullName(), this.GetFilterSQL("WHERE"))
 }
 
 func (this *Task) GetChunkSqlQuery() string {
 	keyForChunks := this.Table.GetPrimaryOrUniqueKey()
 
-	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s >= %d LIMIT 1 OFFSET %d", keyForChunks, this.Table.GetFullName(), keyForChunks, this.chunkMax, this.ChunkSize)
+	// A value of a non unique key can be repeated more times than the chunk
+	// size, the next chunk starts after the last value to always advance.
+	if !this.Table.IsKeyForChunksUnique() {
+		return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= %d%s ORDER BY %s LIMIT 1 OFFSET %d", keyForChunks, this.Table.GetFullName(), keyForChunks, this.chunkMin, this.GetFilterSQL("AND"), keyForChunks, this.ChunkSize)
+	}
+
+	// The order of the rows is only guaranteed with the ORDER BY, the chunk
+	// key can be a secondary unique key.
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s >= %d%s ORDER BY %s LIMIT 1 OFFSET %d", keyForChunks, this.Table.GetFullName(), keyForChunks, this.chunkMax, this.GetFilterSQL("AND"), keyForChunks, this.ChunkSize)
 
 	return query
 }
@@ -43,8 +133,249 @@ func (this *Task) GetChunkSqlQuery() string {
 func (this *Task) GetLastChunkSqlQuery() string {
 
 	keyForChunks := this.Table.GetPrimaryOrUniqueKey()
-	return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= %d LIMIT 1",
-		keyForChunks, this.Table.GetFullName(), keyForChunks, this.chunkMin)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= %d%s ORDER BY %s LIMIT 1",
+		keyForChunks, this.Table.GetFullName(), keyForChunks, this.chunkMin, this.GetFilterSQL("AND"), keyForChunks)
+}
+
+// GetKeyRangeSQL return the query to get the minimum and the maximum of the
+// key used to split the table.
+func (this *Task) GetKeyRangeSQL() string {
+	keyForChunks := this.Table.GetPrimaryOrUniqueKey()
+	return fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s%s",
+		keyForChunks, keyForChunks, this.Table.GetFullName(), this.GetFilterSQL("WHERE"))
+}
+
+// maxRangeSparseness is how many times the chunks of the range strategy can
+// exceed the chunks needed by the estimated rows of the table. Sparser keys
+// use the offset strategy instead of creating mostly empty chunks.
+const maxRangeSparseness = 10
+
+// GetRangeChunksLimits return the lower limit of each chunk that splits the
+// keys from min to max in steps. Each chunk ends before the next limit and
+// the last one ends at max.
+func GetRangeChunksLimits(min, max, step int64) []int64 {
+	if step < 1 {
+		step = 1
+	}
+	var limits []int64
+	for start := min; ; start += step {
+		limits = append(limits, start)
+		// The unsigned difference doesn't overflow with the negative keys.
+		if uint64(max)-uint64(start) < uint64(step) {
+			return limits
+		}
+	}
+}
+
+// isRangeSparse return true if the keys from min to max need far more chunks
+// than the estimated rows of the table.
+func (this *Task) isRangeSparse(min, max int64) bool {
+	step := this.ChunkSize
+	if step < 1 {
+		step = 1
+	}
+	chunks := (uint64(max) - uint64(min)) / step
+	return chunks >= maxRangeSparseness*(this.Table.estNumberOfRows/step+1)
+}
+
+// getKeyRange return the minimum and the maximum of the key, they are not
+// valid if the table doesn't have any row.
+func (this *Task) getKeyRange(db *sql.DB) (min, max sql.NullInt64) {
+	if err := db.QueryRow(this.GetKeyRangeSQL()).Scan(&min, &max); err != nil {
+		log.Fatalf("Error getting the range of the key of the table %s: %s",
+			this.Table.GetFullName(), err.Error())
+	}
+	return min, max
+}
+
+// addLimitsChunks create a chunk for each lower limit. Each chunk ends before
+// the next limit and the last chunk has no upper limit.
+func (this *Task) addLimitsChunks(limits []int64) {
+	for i, start := range limits {
+		this.chunkMin = start
+		if i == len(limits)-1 {
+			this.AddChunk(NewDataLastChunk(this))
+			break
+		}
+		this.chunkMax = limits[i+1] - 1
+		this.AddChunk(NewDataChunk(this))
+	}
+}
+
+// createRangeChunks create the chunks with the range strategy. It returns
+// false without creating any chunk if the keys are too sparse and the offset
+// strategy must be used.
+func (this *Task) createRangeChunks(db *sql.DB) bool {
+	min, max := this.getKeyRange(db)
+	if !min.Valid {
+		return true
+	}
+	if this.isRangeSparse(min.Int64, max.Int64) {
+		log.Warningf("The keys of the table %s from %d to %d are too sparse for the %d estimated rows, using the %s chunk strategy.",
+			this.Table.GetFullName(), min.Int64, max.Int64, this.Table.estNumberOfRows, ChunkStrategyOffset)
+		return false
+	}
+
+	this.addLimitsChunks(GetRangeChunksLimits(min.Int64, max.Int64, int64(this.ChunkSize)))
+	return true
+}
+
+// GetHistogramSQL return the query to get the histogram of the key used to
+// split the table.
+func (this *Task) GetHistogramSQL() string {
+	return fmt.Sprintf(`SELECT HISTOGRAM FROM INFORMATION_SCHEMA.COLUMN_STATISTICS
+		WHERE SCHEMA_NAME='%s' AND TABLE_NAME='%s' AND COLUMN_NAME='%s'`,
+		this.Table.GetUnescapedSchema(), this.Table.GetUnescapedName(), this.Table.GetPrimaryOrUniqueKey())
+}
+
+// GetHistogramChunksLimits return the lower limit of each chunk from the
+// histogram of the key. The buckets are split in chunks of chunkSize of the
+// estimated rows, interpolating the keys inside of each bucket. The first
+// limit is min because the histogram can miss the new rows.
+func GetHistogramChunksLimits(histogram []byte, min int64, rows, chunkSize uint64) ([]int64, error) {
+	var stats struct {
+		Buckets [][]json.Number `json:"buckets"`
+		Type    string          `json:"histogram-type"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(histogram))
+	decoder.UseNumber()
+	if err := decoder.Decode(&stats); err != nil {
+		return nil, fmt.Errorf("Invalid histogram: %s", err.Error())
+	}
+	if rows == 0 || chunkSize == 0 {
+		return nil, fmt.Errorf("The table doesn't have estimated rows")
+	}
+
+	limits := []int64{min}
+	step := float64(chunkSize) / float64(rows)
+	next, previous := step, float64(0)
+	for _, bucket := range stats.Buckets {
+		// The singleton buckets are [value, frequency] and the equi-height
+		// buckets are [lower, upper, frequency, distinct values].
+		var (
+			values    []int64
+			frequency float64
+			err       error
+		)
+		switch {
+		case stats.Type == "singleton" && len(bucket) == 2:
+			values = make([]int64, 1)
+		case stats.Type == "equi-height" && len(bucket) == 4:
+			values = make([]int64, 2)
+		default:
+			return nil, fmt.Errorf("Invalid bucket %v of the %s histogram", bucket, stats.Type)
+		}
+		for i := range values {
+			if values[i], err = bucket[i].Int64(); err != nil {
+				return nil, fmt.Errorf("Invalid value of the histogram: %s", err.Error())
+			}
+		}
+		if frequency, err = bucket[len(values)].Float64(); err != nil {
+			return nil, fmt.Errorf("Invalid frequency of the histogram: %s", err.Error())
+		}
+
+		lower, upper := values[0], values[len(values)-1]
+		for ; next < frequency && next < 1; next += step {
+			key := lower + int64((next-previous)/(frequency-previous)*(float64(upper)-float64(lower)))
+			if key > limits[len(limits)-1] {
+				limits = append(limits, key)
+			}
+		}
+		previous = frequency
+	}
+	return limits, nil
+}
+
+// createStatisticsChunks create the chunks with the histogram of the key. It
+// returns false without creating any chunk if the key doesn't have a valid
+// histogram and the offset strategy must be used.
+func (this *Task) createStatisticsChunks(db *sql.DB) bool {
+	var histogram []byte
+	err := db.QueryRow(this.GetHistogramSQL()).Scan(&histogram)
+	if err == nil {
+		min, _ := this.getKeyRange(db)
+		if !min.Valid {
+			return true
+		}
+		var limits []int64
+		if limits, err = GetHistogramChunksLimits(histogram, min.Int64, this.Table.estNumberOfRows, this.ChunkSize); err == nil {
+			this.addLimitsChunks(limits)
+			return true
+		}
+	}
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("The column %s doesn't have a histogram, it is created with ANALYZE TABLE ... UPDATE HISTOGRAM", this.Table.GetPrimaryOrUniqueKey())
+	}
+	log.Warningf("Error getting the statistics of the key of the table %s: %s, using the %s chunk strategy.",
+		this.Table.GetFullName(), err.Error(), ChunkStrategyOffset)
+	return false
+}
+
+// samplesPerChunk is the number of keys sampled for each chunk. More samples
+// make the size of the chunks more even.
+const samplesPerChunk = 10
+
+// GetSampleSQL return the query to read a random sample of the keys in order,
+// about samplesPerChunk keys for each chunk.
+func (this *Task) GetSampleSQL() string {
+	keyForChunks := this.Table.GetPrimaryOrUniqueKey()
+	rate := float64(1)
+	if this.ChunkSize > samplesPerChunk {
+		rate = float64(samplesPerChunk) / float64(this.ChunkSize)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s WHERE RAND() < %g%s ORDER BY %s",
+		keyForChunks, this.Table.GetFullName(), rate, this.GetFilterSQL("AND"), keyForChunks)
+}
+
+// GetSampleChunksLimits return the lower limit of each chunk from the sampled
+// keys in order, a chunk starts every perChunk samples. The first limit is
+// min because the sample can miss the first rows.
+func GetSampleChunksLimits(min int64, samples []int64, perChunk int) []int64 {
+	if perChunk < 1 {
+		perChunk = 1
+	}
+	limits := []int64{min}
+	for i := perChunk; i < len(samples); i += perChunk {
+		if samples[i] > limits[len(limits)-1] {
+			limits = append(limits, samples[i])
+		}
+	}
+	return limits
+}
+
+// createSampleChunks create the chunks with a random sample of the keys.
+func (this *Task) createSampleChunks(db *sql.DB) {
+	min, _ := this.getKeyRange(db)
+	if !min.Valid {
+		return
+	}
+
+	rows, err := db.Query(this.GetSampleSQL())
+	if err != nil {
+		log.Fatalf("Error sampling the keys of the table %s: %s",
+			this.Table.GetFullName(), err.Error())
+	}
+	defer rows.Close()
+
+	var samples []int64
+	for rows.Next() {
+		var key int64
+		if err := rows.Scan(&key); err != nil {
+			log.Fatalf("Error sampling the keys of the table %s: %s",
+				this.Table.GetFullName(), err.Error())
+		}
+		samples = append(samples, key)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Error sampling the keys of the table %s: %s",
+			this.Table.GetFullName(), err.Error())
+	}
+
+	perChunk := samplesPerChunk
+	if this.ChunkSize < samplesPerChunk {
+		perChunk = int(this.ChunkSize)
+	}
+	this.addLimitsChunks(GetSampleChunksLimits(min.Int64, samples, perChunk))
 }
 
 func (this *Task) CreateChunks(db *sql.DB) {
@@ -82,6 +413,22 @@ func (this *Task) CreateChunks(db *sql.DB) {
 		}
 	}
 
+	var done bool
+	switch this.ChunkStrategy {
+	case ChunkStrategyRange:
+		done = this.createRangeChunks(tx)
+	case ChunkStrategyStatistics:
+		done = this.createStatisticsChunks(tx)
+	case ChunkStrategySample:
+		this.createSampleChunks(tx)
+		done = true
+	}
+	if done {
+		log.Debugf("Table processed %s - %d chunks created",
+			this.Table.GetFullName(), this.TotalChunks)
+		return
+	}
+
 	for !stopLoop {
 
 		err := tx.QueryRow(this.GetChunkSqlQuery()).Scan(&chunkMax)
@@ -95,6 +442,7 @@ func (this *Task) CreateChunks(db *sql.DB) {
 		} else {
 			this.chunkMax = chunkMax
 			this.AddChunk(NewDataChunk(this))
+			this.resizeChunk()
 		}
 	}
 
@@ -119,9 +467,41 @@ func NewTask(schema string,
 	outputChunkSize uint64,
 	tm *TaskManager) Task {
 
+	t := NewTable(schema, table, tm.DB)
+	if columns, ok := tm.ExcludedColumns[t.GetUnescapedFullName()]; ok {
+		if err := t.ExcludeColumns(columns); err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+	}
+
+	var where string
+	chunkStrategy := tm.ChunkStrategy
+	if tm.ChunkTargetSize > 0 {
+		chunkSize = t.GetChunkSizeForTarget(tm.ChunkTargetSize, chunkSize)
+		log.Debugf("Table %s: average row length %d bytes, chunk size %d rows",
+			t.GetUnescapedFullName(), t.GetAverageRowLength(), chunkSize)
+	}
+	if options, ok := tm.TableOptions[t.GetUnescapedFullName()]; ok {
+		if options.ChunkSize > 0 {
+			chunkSize = options.ChunkSize
+		}
+		if options.ChunkKey != "" {
+			if err := t.SetKeyForChunks(options.ChunkKey); err != nil {
+				log.Fatalf("%s", err.Error())
+			}
+		}
+		where = options.Where
+		if options.ChunkStrategy != "" {
+			chunkStrategy = options.ChunkStrategy
+		}
+	}
+
 	return Task{
-		Table:           NewTable(schema, table, tm.DB),
+		Table:           t,
 		ChunkSize:       chunkSize,
+		initialSize:     chunkSize,
 		OutputChunkSize: outputChunkSize,
+		Where:           where,
+		ChunkStrategy:   chunkStrategy,
 		TaskManager:     tm}
 }
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"fmt"
 	"testing"
+	"time"
 )
 
 var task1 = NewTask("sakila", "city", 1000, 1000, &taskManager)
@@ -32,15 +34,15 @@ func TestTaskGetChunkSqlQuery(t *testing.T) {
 		{table: task1.Table,
 			chunkSize: 100,
 			chunkMax:  1570,
-			expect:    "SELECT city_id FROM `sakila`.`city` WHERE city_id >= 1570 LIMIT 1 OFFSET 100"},
+			expect:    "SELECT city_id FROM `sakila`.`city` WHERE city_id >= 1570 ORDER BY city_id LIMIT 1 OFFSET 100"},
 		{table: task2.Table,
 			chunkSize: 1500,
 			chunkMax:  0,
-			expect:    "SELECT country_id FROM `sakila`.`country` WHERE country_id >= 0 LIMIT 1 OFFSET 1500"},
+			expect:    "SELECT country_id FROM `sakila`.`country` WHERE country_id >= 0 ORDER BY country_id LIMIT 1 OFFSET 1500"},
 		{table: task3.Table,
 			chunkSize: 500,
 			chunkMax:  1000,
-			expect:    "SELECT manager_staff_id FROM `sakila`.`store_no_pk` WHERE manager_staff_id >= 1000 LIMIT 1 OFFSET 500"},
+			expect:    "SELECT manager_staff_id FROM `sakila`.`store_no_pk` WHERE manager_staff_id >= 1000 ORDER BY manager_staff_id LIMIT 1 OFFSET 500"},
 	}
 	for _, tt := range tablesChunk {
 		task := Task{
@@ -62,13 +64,13 @@ func TestTaskGetLastChunkSqlQuery(t *testing.T) {
 
 		{table: table1,
 			chunkMin: 1570,
-			expect:   "SELECT pk FROM `schema1`.`table1` WHERE pk >= 1570 LIMIT 1"},
+			expect:   "SELECT pk FROM `schema1`.`table1` WHERE pk >= 1570 ORDER BY pk LIMIT 1"},
 		{table: table2,
 			chunkMin: 100,
-			expect:   "SELECT pk FROM `schema2`.`table2` WHERE pk >= 100 LIMIT 1"},
+			expect:   "SELECT pk FROM `schema2`.`table2` WHERE pk >= 100 ORDER BY pk LIMIT 1"},
 		{table: table3,
 			chunkMin: 500,
-			expect:   "SELECT uk FROM `schema3`.`table3` WHERE uk >= 500 LIMIT 1"},
+			expect:   "SELECT uk FROM `schema3`.`table3` WHERE uk >= 500 ORDER BY uk LIMIT 1"},
 	}
 	for _, tt := range tablesLastChunk {
 		task := Task{
@@ -90,3 +92,184 @@ func TestGetLockTablesSQL(t *testing.T) {
 	//taskManager.GetTransactions(true, false)
 
 }
+
+func TestTaskGetFilterSQL(t *testing.T) {
+	task := &Task{Table: table1, TaskManager: &TaskManager{}, Where: "created > '2020-01-01'"}
+
+	single := NewSingleDataChunk(task)
+	if got := single.GetPrepareSQL(); got != "SELECT /*!40001 SQL_NO_CACHE */ * FROM `schema1`.`table1` WHERE (created > '2020-01-01')" {
+		t.Errorf("Unexpected single chunk query: %s", got)
+	}
+	chunk := NewDataChunk(task)
+	if got := chunk.GetWhereSQL(); got != " WHERE pk BETWEEN ? AND ? AND (created > '2020-01-01')" {
+		t.Errorf("Unexpected chunk condition: %s", got)
+	}
+	task.chunkMax = 100
+	task.ChunkSize = 10
+	if got := task.GetChunkSqlQuery(); got != "SELECT pk FROM `schema1`.`table1` WHERE pk >= 100 AND (created > '2020-01-01') ORDER BY pk LIMIT 1 OFFSET 10" {
+		t.Errorf("Unexpected chunk query: %s", got)
+	}
+}
+
+func TestTaskGetKeyRangeSQL(t *testing.T) {
+	task := &Task{Table: table1, TaskManager: &TaskManager{}, Where: "active = 1"}
+	if got := task.GetKeyRangeSQL(); got != "SELECT MIN(pk), MAX(pk) FROM `schema1`.`table1` WHERE (active = 1)" {
+		t.Errorf("Unexpected range query: %s", got)
+	}
+}
+
+func TestGetRangeChunksLimits(t *testing.T) {
+	ranges := []struct {
+		min, max, step int64
+		expect         []int64
+	}{
+		{1, 30, 10, []int64{1, 11, 21}},
+		{1, 25, 10, []int64{1, 11, 21}},
+		{-15, 4, 10, []int64{-15, -5}},
+		{-15, 5, 10, []int64{-15, -5, 5}},
+		{7, 7, 10, []int64{7}},
+		{-9223372036854775808, -9223372036854775808, 1, []int64{-9223372036854775808}},
+		{9223372036854775800, 9223372036854775807, 5, []int64{9223372036854775800, 9223372036854775805}},
+	}
+
+	for _, tt := range ranges {
+		got := GetRangeChunksLimits(tt.min, tt.max, tt.step)
+		if fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("Range %d..%d step %d: got %v and expected %v", tt.min, tt.max, tt.step, got, tt.expect)
+		}
+	}
+}
+
+func TestTaskIsRangeSparse(t *testing.T) {
+	task := &Task{Table: &Table{estNumberOfRows: 1000}, ChunkSize: 100}
+	if task.isRangeSparse(1, 1000) || task.isRangeSparse(-500, 500) {
+		t.Errorf("A dense range shouldn't be sparse")
+	}
+	if !task.isRangeSparse(1, 1000000) {
+		t.Errorf("A range of a million keys with 1000 rows should be sparse")
+	}
+	if !task.isRangeSparse(-9223372036854775808, 9223372036854775807) {
+		t.Errorf("The full range of BIGINT should be sparse")
+	}
+}
+
+func TestTaskGetHistogramSQL(t *testing.T) {
+	task := &Task{Table: table1, TaskManager: &TaskManager{}}
+	expect := `SELECT HISTOGRAM FROM INFORMATION_SCHEMA.COLUMN_STATISTICS
+		WHERE SCHEMA_NAME='schema1' AND TABLE_NAME='table1' AND COLUMN_NAME='pk'`
+	if got := task.GetHistogramSQL(); got != expect {
+		t.Errorf("Unexpected histogram query: %s", got)
+	}
+}
+
+func TestGetHistogramChunksLimits(t *testing.T) {
+	histograms := []struct {
+		histogram  string
+		min        int64
+		rows, size uint64
+		expect     []int64
+	}{
+		{`{"buckets": [[1, 100, 0.5, 100], [101, 1000, 1.0, 900]], "histogram-type": "equi-height"}`, 1, 200, 50, []int64{1, 50, 101, 550}},
+		{`{"buckets": [[10, 0.25], [20, 0.5], [30, 0.75], [40, 1.0]], "histogram-type": "singleton"}`, 5, 4, 2, []int64{5, 30}},
+		{`{"buckets": [[1, 1000, 1.0, 1000]], "histogram-type": "equi-height"}`, 500, 1000, 250, []int64{500, 750}},
+		{`{"buckets": [], "histogram-type": "equi-height"}`, 7, 1000, 10, []int64{7}},
+	}
+
+	for _, tt := range histograms {
+		got, err := GetHistogramChunksLimits([]byte(tt.histogram), tt.min, tt.rows, tt.size)
+		if err != nil {
+			t.Errorf("Histogram %s: %s", tt.histogram, err.Error())
+		} else if fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("Histogram %s: got %v and expected %v", tt.histogram, got, tt.expect)
+		}
+	}
+
+	for _, histogram := range []string{
+		`{"buckets": [["YWJj", 1.0]], "histogram-type": "singleton"}`,
+		`{"buckets": [[1, 1.0]], "histogram-type": "equi-height"}`,
+		`not json`,
+	} {
+		if _, err := GetHistogramChunksLimits([]byte(histogram), 1, 100, 10); err == nil {
+			t.Errorf("Histogram %s should fail", histogram)
+		}
+	}
+	if _, err := GetHistogramChunksLimits([]byte(`{"buckets": []}`), 1, 0, 10); err == nil {
+		t.Errorf("A table without estimated rows should fail")
+	}
+}
+
+func TestTaskGetSampleSQL(t *testing.T) {
+	task := &Task{Table: table1, TaskManager: &TaskManager{}, ChunkSize: 1000, Where: "active = 1"}
+	if got := task.GetSampleSQL(); got != "SELECT pk FROM `schema1`.`table1` WHERE RAND() < 0.01 AND (active = 1) ORDER BY pk" {
+		t.Errorf("Unexpected sample query: %s", got)
+	}
+	task.ChunkSize = 5
+	if got := task.GetSampleSQL(); got != "SELECT pk FROM `schema1`.`table1` WHERE RAND() < 1 AND (active = 1) ORDER BY pk" {
+		t.Errorf("Unexpected sample query: %s", got)
+	}
+}
+
+func TestGetSampleChunksLimits(t *testing.T) {
+	samples := []struct {
+		min      int64
+		samples  []int64
+		perChunk int
+		expect   []int64
+	}{
+		{1, []int64{3, 5, 8, 13, 21, 34, 55}, 2, []int64{1, 8, 21, 55}},
+		{1, []int64{3, 5, 8}, 10, []int64{1}},
+		{1, []int64{1, 1, 2, 2, 2, 3}, 1, []int64{1, 2, 3}},
+		{-10, nil, 0, []int64{-10}},
+	}
+
+	for _, tt := range samples {
+		got := GetSampleChunksLimits(tt.min, tt.samples, tt.perChunk)
+		if fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("Samples %v every %d: got %v and expected %v", tt.samples, tt.perChunk, got, tt.expect)
+		}
+	}
+}
+
+func TestGetChunkSizeForTime(t *testing.T) {
+	sizes := []struct {
+		rows            uint64
+		elapsed, target time.Duration
+		initial, expect uint64
+	}{
+		{0, 0, time.Second, 1000, 1000},
+		{0, time.Second, time.Second, 1000, 1000},
+		{1000, 0, time.Second, 1000, 1000},
+		{1000, 2 * time.Second, 10 * time.Second, 1000, 5000},
+		{3000, 3 * time.Second, 500 * time.Millisecond, 1000, 500},
+		{1000000, time.Second, time.Second, 1000, 10000},
+		{10, 10 * time.Second, time.Second, 1000, 100},
+		{1, time.Minute, time.Second, 5, 1},
+	}
+
+	for _, tt := range sizes {
+		if got := GetChunkSizeForTime(tt.rows, tt.elapsed, tt.target, tt.initial); got != tt.expect {
+			t.Errorf("%d rows in %s with target %s and initial %d: got %d and expected %d",
+				tt.rows, tt.elapsed, tt.target, tt.initial, got, tt.expect)
+		}
+	}
+}
+
+func TestTaskResizeChunk(t *testing.T) {
+	task := &Task{Table: table1, TaskManager: &TaskManager{ChunkTargetTime: time.Second}, ChunkSize: 1000, initialSize: 1000}
+	task.resizeChunk()
+	if task.ChunkSize != 1000 {
+		t.Errorf("The chunk size shouldn't change before dumping a chunk, got %d", task.ChunkSize)
+	}
+	task.AddChunkDuration(1000, 500*time.Millisecond)
+	task.AddChunkDuration(2000, 1500*time.Millisecond)
+	task.resizeChunk()
+	if task.ChunkSize != 1500 {
+		t.Errorf("Unexpected chunk size %d, expected 1500", task.ChunkSize)
+	}
+	task.TaskManager.ChunkTargetTime = 0
+	task.ChunkSize = 10
+	task.resizeChunk()
+	if task.ChunkSize != 10 {
+		t.Errorf("The chunk size shouldn't change without target time, got %d", task.ChunkSize)
+	}
+}
@@ -4,20 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/outbrain/golib/log"
 )
 
+// NewTaskManager create the task manager of the dump. It returns an error if
+// the information of the server can't be read.
 func NewTaskManager(
 	wgC *sync.WaitGroup,
 	wgP *sync.WaitGroup,
 	cDC chan DataChunk,
 	db *sql.DB,
-	dumpOptions *DumpOptions) TaskManager {
+	dumpOptions *DumpOptions) (TaskManager, error) {
 
 	tm := TaskManager{
 		CreateChunksWaitGroup:  wgC,
@@ -34,9 +38,40 @@ func NewTaskManager(
 		Compress:               dumpOptions.Compress,
 		CompressLevel:          dumpOptions.CompressLevel,
 		IsolationLevel:         dumpOptions.IsolationLevel,
+		MaskingRules:           dumpOptions.MaskingRules,
+		ExcludedColumns:        dumpOptions.ExcludedColumns,
+		TableOptions:           dumpOptions.TableOptions,
+		HexBlob:                dumpOptions.HexBlob,
+		InsertMode:             dumpOptions.InsertMode,
+		ChunkStrategy:          dumpOptions.ChunkStrategy,
+		ChunkThreads:           dumpOptions.ChunkThreads,
+		ChunkTargetSize:        dumpOptions.ChunkTargetSize,
+		ChunkTargetTime:        time.Duration(dumpOptions.ChunkTargetTime) * time.Second,
+		NoData:                 dumpOptions.NoData,
+		NoCreateInfo:           dumpOptions.NoCreateInfo,
+		OutputLayout:           dumpOptions.OutputLayout,
+		MaxFileSize:            dumpOptions.MaxFileSize,
+		LockMode:               dumpOptions.LockMode,
+		ReplicationDataFormat:  dumpOptions.ReplicationDataFormat,
+		ReplicationSyntax:      dumpOptions.ReplicationSyntax,
+		ReplicationGTID:        dumpOptions.ReplicationGTID,
+		LockWaitTimeout:        time.Duration(dumpOptions.LockWaitTimeout) * time.Second,
+		LongQueryGuard:         time.Duration(dumpOptions.LongQueryGuard) * time.Second,
+		LongQueryAction:        dumpOptions.LongQueryAction,
+		LongQueryWait:          time.Duration(dumpOptions.LongQueryWait) * time.Second,
+		outputFilesMutex:       new(sync.Mutex),
+		nonTransactionalWG:     new(sync.WaitGroup),
+		nonTransactionalQueued: make(chan bool),
 		mySQLHost:              dumpOptions.MySQLHost,
 		mySQLCredentials:       dumpOptions.MySQLCredentials}
-	return tm
+
+	server, err := GetServerInfo(db)
+	if err != nil {
+		return tm, fmt.Errorf("Error getting the server information: %s", err.Error())
+	}
+	tm.Server = server
+	tm.SessionVariables = GetSessionVariables(server, dumpOptions.SessionVariables)
+	return tm, nil
 }
 
 type TaskManager struct {
@@ -44,13 +79,15 @@ type TaskManager struct {
 	ProcessChunksWaitGroup *sync.WaitGroup //Create Chunks WaitGroup
 	ChunksChannel          chan DataChunk
 	DB                     *sql.DB
+	Server                 *ServerInfo
+	SessionVariables       map[string]string
 	ThreadsCount           int
 	tasksPool              []*Task
-	workersTx              []*sql.Tx
+	workersConn            []*sql.Conn
 	workersDB              []*sql.DB
 	databaseEngines        map[string]*Table
-	TotalChunks            int64
-	Queue                  int64
+	TotalChunks            int64 // Updated with sync/atomic
+	Queue                  int64 // Updated with sync/atomic
 	DestinationDir         string
 	TablesWithoutPKOption  string
 	SkipUseDatabase        bool
@@ -59,6 +96,41 @@ type TaskManager struct {
 	Compress               bool
 	CompressLevel          int
 	IsolationLevel         sql.IsolationLevel
+	MaskingRules           *MaskingRules
+	ExcludedColumns        map[string][]string
+	TableOptions           map[string]*TableOptions
+	HexBlob                bool
+	InsertMode             string
+	ChunkStrategy          string
+	ChunkThreads           int
+	ChunkTargetSize        uint64
+	ChunkTargetTime        time.Duration
+	NoData                 bool
+	NoCreateInfo           bool
+	OutputLayout           string
+	MaxFileSize            uint64
+	LockMode               string
+	ReplicationDataFormat  string
+	ReplicationSyntax      string
+	ReplicationGTID        bool
+	LockWaitTimeout        time.Duration
+	LongQueryGuard         time.Duration
+	LongQueryAction        string
+	LongQueryWait          time.Duration
+	lockConn               *sql.Conn
+	backupLockConn         *sql.Conn
+	backupLock             int
+	cloneSnapshot          bool
+	snapshotSessionId      int64
+	snapshotConsistent     bool
+	nonTransactionalLocked bool
+	nonTransactionalWG     *sync.WaitGroup
+	nonTransactionalQueued chan bool
+	tablesUnlocked         chan bool
+	definitionFiles        map[string]string
+	dataFiles              map[string][][]string
+	collatedFiles          []string
+	outputFilesMutex       *sync.Mutex
 	mySQLHost              *MySQLHost
 	mySQLCredentials       *MySQLCredentials
 }
@@ -74,6 +146,17 @@ func (this *TaskManager) addDatabaseEngine(t *Table) {
 	}
 }
 
+// HasNonTransactionalTables return true if any table to dump has an engine
+// without consistent snapshots.
+func (this *TaskManager) HasNonTransactionalTables() bool {
+	for _, t := range this.databaseEngines {
+		if !t.IsTransactional() {
+			return true
+		}
+	}
+	return false
+}
+
 func (this *TaskManager) AddTask(t *Task) {
 	if len(this.tasksPool) == 0 {
 		t.Id = 0
@@ -89,9 +172,13 @@ func (this *TaskManager) GetTasksPool() []*Task {
 }
 
 func (this *TaskManager) AddWorkersDB() {
+	if this.NoData {
+		log.Debugf("Skipping the workers connections, the data is not dumped.")
+		return
+	}
 	for i := 0; i < this.ThreadsCount; i++ {
 
-		conn, err := GetMySQLConnection(this.mySQLHost, this.mySQLCredentials)
+		conn, err := GetMySQLSessionConnection(this.mySQLHost, this.mySQLCredentials, this.SessionVariables)
 		if err != nil {
 			log.Critical("Error whith the database connection. %s", err.Error())
 		}
@@ -103,73 +190,75 @@ func (this *TaskManager) AddWorkersDB() {
 
 func (this *TaskManager) AddWorkerDB(db *sql.DB) {
 	this.workersDB = append(this.workersDB, db)
-	this.workersTx = append(this.workersTx, nil)
+	this.workersConn = append(this.workersConn, nil)
 }
 
 func (this *TaskManager) lockTables() {
 	query := GetLockTablesSQL(this.tasksPool, "READ")
 
-	if _, err := this.DB.Exec(query); err != nil {
-		log.Criticalf("Error unlocking the tables: %s", err.Error())
+	if err := this.execLock(this.lockConn, query); err != nil {
+		this.ReleaseLocks()
+		log.Fatalf("Error locking the tables: %s", err.Error())
 	}
 }
 
 func (this *TaskManager) unlockTables() {
 	log.Debugf("Unlocking tables")
-	if _, err := this.DB.Exec("UNLOCK TABLES"); err != nil {
+	if _, err := this.lockConn.ExecContext(context.Background(), "UNLOCK TABLES"); err != nil {
 		log.Criticalf("Error unlocking the tables: %s", err.Error())
 	}
 }
 
 func (this *TaskManager) lockAllTables() {
+	this.checkLongQueries()
+
 	query := GetLockAllTablesSQL()
-	if _, err := this.DB.Exec(query); err != nil {
+	if err := this.execLock(this.lockConn, query); err != nil {
+		this.ReleaseLocks()
 		log.Fatalf("Error locking table: %s", err.Error())
 	}
 }
 
+// createWorkers open one connection per worker and start its transaction.
+// With Percona Server the workers clone the snapshot of the first worker,
+// otherwise the writes are blocked while the transactions start.
 func (this *TaskManager) createWorkers() {
+	ctx := context.Background()
 	for i, dbW := range this.workersDB {
-		//log.Infof("Starting worker %d", i)
-		if this.workersTx[i] == nil {
-			txW, _ := dbW.BeginTx(context.Background(), &sql.TxOptions{
-				Isolation: this.IsolationLevel,
-				ReadOnly:  true})
-			for engine, table := range this.databaseEngines {
-				txW.Exec(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", table.GetFullName()))
-				log.Debugf("Selecting a table from engine: %s", engine)
-			}
-			this.workersTx[i] = txW
+		if this.workersConn[i] != nil {
+			continue
+		}
+		conn := getConn(dbW)
+		if _, err := conn.ExecContext(ctx, GetIsolationLevelSQL(this.IsolationLevel)); err != nil {
+			log.Fatalf("Error setting the isolation level of the worker %d: %s", i, err.Error())
 		}
-	}
-}
 
-func (this *TaskManager) isMultiMaster() (bool, error) {
-	_, err := this.DB.Query("SELECT @@default_master_connection")
-	switch err {
-	case sql.ErrNoRows:
-		return false, nil
-	case nil:
-		return true, nil
-	default:
-		return false, err
-	}
+		query := GetStartTransactionSQL(this.IsolationLevel)
+		if this.cloneSnapshot && i > 0 {
+			query = GetCloneSnapshotSQL(this.snapshotSessionId)
+		}
+		log.Debugf("Starting the transaction of the worker %d: %s", i, query)
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			log.Fatalf("Error starting the transaction of the worker %d: %s", i, err.Error())
+		}
 
+		if this.cloneSnapshot && i == 0 {
+			if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&this.snapshotSessionId); err != nil {
+				log.Fatalf("Error getting the connection id of the worker %d: %s", i, err.Error())
+			}
+		}
+		this.workersConn[i] = conn
+	}
 }
 
 // getSlaveData collects the slave data from the node that you are taking the backup.
 // It detect if the slave has multi master replication and collect and store the information for all the channels.
 func (this *TaskManager) getSlaveData() {
 	log.Info("Getting Slave Status")
-	isMultiMaster, _ := this.isMultiMaster()
-	var query string
+	query := this.Server.SlaveStatusSQL()
+	log.Debugf("Slave status query: %s", query)
 
-	if isMultiMaster {
-		query = "SHOW ALL SLAVES STATUS"
-	} else {
-		query = "SHOW SLAVE STATUS"
-	}
-	slaveData, err := this.DB.Query(query)
+	slaveData, err := this.lockConn.QueryContext(context.Background(), query)
 
 	if err != nil {
 		log.Fatalf("Error getting slave information: %s", err.Error())
@@ -184,13 +273,13 @@ func (this *TaskManager) getSlaveData() {
 
 	for i := 0; i < len(cols); i++ {
 		switch strings.ToUpper(cols[i]) {
-		case "CONNECTION_NAME":
+		case "CONNECTION_NAME", "CHANNEL_NAME":
 			out = append(out, &connectionName)
-		case "RELAY_MASTER_LOG_FILE":
+		case "RELAY_MASTER_LOG_FILE", "RELAY_SOURCE_LOG_FILE":
 			out = append(out, &relayMasterLogFile)
-		case "MASTER_HOST":
+		case "MASTER_HOST", "SOURCE_HOST":
 			out = append(out, &masterHost)
-		case "MASTER_PORT":
+		case "MASTER_PORT", "SOURCE_PORT":
 			out = append(out, &masterPort)
 		case "EXECUTED_GTID_SET":
 			haveExecutedGtidSet = true
@@ -198,13 +287,14 @@ func (this *TaskManager) getSlaveData() {
 		case "GTID_SLAVE_POS":
 			haveGtidSlavePos = true
 			out = append(out, &gtidSlavePos)
-		case "EXEC_MASTER_LOG_POS":
+		case "EXEC_MASTER_LOG_POS", "EXEC_SOURCE_LOG_POS":
 			out = append(out, &execMasterLogPos)
 		default:
 			out = append(out, new(interface{}))
 		}
 	}
 	buffer, _ := NewSlaveDataBuffer(this)
+	syntax := this.Server.ReplicationSyntax(this.ReplicationSyntax)
 
 	for slaveData.Next() {
 		iterations++
@@ -212,6 +302,22 @@ func (this *TaskManager) getSlaveData() {
 			log.Fatalf(err.Error())
 		}
 
+		if this.ReplicationDataFormat == ReplicationDataFormatSQL {
+			coordinates := &ReplicationCoordinates{
+				Channel:  connectionName,
+				Host:     masterHost,
+				Port:     masterPort,
+				File:     relayMasterLogFile,
+				Position: execMasterLogPos,
+				GtidSet:  executedGtidSet,
+				GtidPos:  gtidSlavePos,
+				MariaDB:  haveGtidSlavePos,
+			}
+			// The GTID state is global, it is the same for all the channels.
+			fmt.Fprint(buffer, coordinates.GetSQL(syntax, this.ReplicationGTID, iterations == 1))
+			continue
+		}
+
 		fmt.Fprintln(buffer, "Connection Name: ", connectionName)
 		fmt.Fprintln(buffer, "  Relay Master Log File: ", relayMasterLogFile)
 		fmt.Fprintln(buffer, "  Master Host: ", masterHost)
@@ -232,63 +338,192 @@ func (this *TaskManager) getSlaveData() {
 	}
 }
 
+// MasterStatus contains the binary log coordinates of the dump.
+type MasterStatus struct {
+	File            string
+	Position        uint64
+	BinlogDoDB      string
+	BinlogIgnoreDB  string
+	ExecutedGtidSet string
+	SupportGTID     bool
+}
+
 func (this *TaskManager) getMasterData() {
 
 	log.Info("Getting Master Status")
 
-	var masterFile, binlogDoDb, binlogIgnoreDB, executedGTIDSet string
-	var masterPosition int
+	var status *MasterStatus
+	if this.useSnapshotMasterStatus() {
+		status = this.getSnapshotMasterStatus()
+	} else {
+		status = this.getMasterStatus()
+	}
+
+	buffer, _ := NewMasterDataBuffer(this)
+
+	if this.ReplicationDataFormat == ReplicationDataFormatSQL {
+		syntax := this.Server.ReplicationSyntax(this.ReplicationSyntax)
+		coordinates := this.getMasterCoordinates(status)
+		if coordinates.Host == "" {
+			fmt.Fprintln(buffer, "-- The host of the source is unknown, add it and its port to the statement.")
+		}
+		fmt.Fprint(buffer, coordinates.GetSQL(syntax, this.ReplicationGTID, true))
+		buffer.Flush()
+		buffer.Close()
+		return
+	}
+
+	fmt.Fprintln(buffer, "Master File:", status.File)
+	fmt.Fprintln(buffer, "Master Position: ", status.Position)
+	fmt.Fprintln(buffer, "Binlog Do DB: ", status.BinlogDoDB)
+	fmt.Fprintln(buffer, "Binlog Ignore DB: ", status.BinlogIgnoreDB)
+	if status.SupportGTID {
+		fmt.Fprintln(buffer, "Executed Gtid Set: ", status.ExecutedGtidSet)
+	}
+	buffer.Flush()
+	buffer.Close()
+}
+
+// getMasterCoordinates return the coordinates to replicate from the dumped
+// server. MariaDB doesn't return the GTID position with SHOW MASTER STATUS,
+// it is calculated from the binary log coordinates.
+func (this *TaskManager) getMasterCoordinates(status *MasterStatus) *ReplicationCoordinates {
+	coordinates := &ReplicationCoordinates{
+		File:     status.File,
+		Position: status.Position,
+		GtidSet:  status.ExecutedGtidSet,
+		MariaDB:  this.Server.IsMariaDB(),
+	}
+	if this.mySQLHost != nil && this.mySQLHost.SocketFile == "" && !IsLoopbackHost(this.mySQLHost.HostName) {
+		coordinates.Host = this.mySQLHost.HostName
+		coordinates.Port = uint64(this.mySQLHost.Port)
+	} else {
+		coordinates.Host, coordinates.Port = this.getServerHost()
+	}
 
-	masterRows, err := this.DB.Query(GetMasterStatusSQL())
+	if coordinates.MariaDB {
+		var gtidPos sql.NullString
+		err := this.lockConn.QueryRowContext(context.Background(), "SELECT BINLOG_GTID_POS(?, ?)",
+			status.File, status.Position).Scan(&gtidPos)
+		if err != nil {
+			log.Warningf("Error getting the GTID position: %s", err.Error())
+		}
+		coordinates.GtidPos = gtidPos.String
+	}
+	return coordinates
+}
+
+// getServerHost return the host and the port that the replicas can use to
+// connect to the dumped server when it was dumped from a local connection.
+// It is the report_host of the server or its host name, and it is empty if
+// the server doesn't report any host that is not local.
+func (this *TaskManager) getServerHost() (string, uint64) {
+	var reportHost, hostName sql.NullString
+	var reportPort, port sql.NullInt64
+	err := this.lockConn.QueryRowContext(context.Background(),
+		"SELECT @@report_host, @@report_port, @@hostname, @@port").Scan(&reportHost, &reportPort, &hostName, &port)
+	if err != nil {
+		log.Warningf("Error getting the host name of the server: %s", err.Error())
+		return "", 0
+	}
+
+	if reportHost.String != "" && !IsLoopbackHost(reportHost.String) {
+		if reportPort.Int64 > 0 {
+			return reportHost.String, uint64(reportPort.Int64)
+		}
+		return reportHost.String, uint64(port.Int64)
+	}
+	if hostName.String != "" && !IsLoopbackHost(hostName.String) {
+		return hostName.String, uint64(port.Int64)
+	}
+	log.Warningf("The server doesn't report a host for the replicas, the host of the source must be added to the replication statements.")
+	return "", 0
+}
+
+// getMasterStatus read the coordinates with SHOW MASTER STATUS, the writes
+// must be blocked to match the snapshot of the workers.
+func (this *TaskManager) getMasterStatus() *MasterStatus {
+	status := new(MasterStatus)
+
+	masterRows, err := this.lockConn.QueryContext(context.Background(), this.Server.MasterStatusSQL())
 	if err != nil {
 		log.Fatalf("%s", err.Error())
 	}
+	defer masterRows.Close()
 	cols, _ := masterRows.Columns()
 
 	if len(cols) < 1 {
 		log.Fatal("Error getting the master data information. Make sure that the logs are enabled. If you want to skip the collection of the master information please use the option --master-data=false. Use --help for more information.")
 	}
 	var out []interface{}
-	supportGTID := false
 
 	for i := 0; i < len(cols); i++ {
 		switch strings.ToUpper(cols[i]) {
 		case "FILE":
-			out = append(out, &masterFile)
+			out = append(out, &status.File)
 		case "POSITION":
-			out = append(out, &masterPosition)
+			out = append(out, &status.Position)
 		case "BINLOG_DO_DB":
-			out = append(out, &binlogDoDb)
+			out = append(out, &status.BinlogDoDB)
 		case "BINLOG_IGNORE_DB":
-			out = append(out, &binlogIgnoreDB)
+			out = append(out, &status.BinlogIgnoreDB)
 		case "EXECUTED_GTID_SET":
-			supportGTID = true
-			out = append(out, &executedGTIDSet)
+			status.SupportGTID = true
+			out = append(out, &status.ExecutedGtidSet)
 		default:
-			log.Warningf("Unknown option \"%s\" on the Mastet Inforamtion. Please report this bug. MASTER DATA WILL NOT BE AVAILABLE!")
+			log.Debugf("Skipping the column \"%s\" of the master status.", cols[i])
+			out = append(out, new(interface{}))
 		}
 	}
 
-	masterRows.Next()
+	if !masterRows.Next() {
+		log.Fatal("Error getting the master data information. Make sure that the logs are enabled. If you want to skip the collection of the master information please use the option --master-data=false. Use --help for more information.")
+	}
 	err = masterRows.Scan(out...)
 	if err != nil {
 		log.Fatalf("Error reading Master data information: %s", err.Error())
 	}
-	masterRows.Close()
-	buffer, _ := NewMasterDataBuffer(this)
+	return status
+}
+
+// getSnapshotMasterStatus read the coordinates of the snapshot of the first
+// worker. Percona Server keeps them in the binlog_snapshot status variables
+// of the session so the writes don't need to be blocked.
+func (this *TaskManager) getSnapshotMasterStatus() *MasterStatus {
+	status := new(MasterStatus)
+
+	rows, err := this.workersConn[0].QueryContext(context.Background(), "SHOW STATUS LIKE 'binlog_snapshot_%'")
+	if err != nil {
+		log.Fatalf("Error reading the snapshot coordinates: %s", err.Error())
+	}
+	defer rows.Close()
 
-	fmt.Fprintln(buffer, "Master File:", masterFile)
-	fmt.Fprintln(buffer, "Master Position: ", masterPosition)
-	fmt.Fprintln(buffer, "Binlog Do DB: ", binlogDoDb)
-	fmt.Fprintln(buffer, "Binlog Ignore DB: ", binlogIgnoreDB)
-	if supportGTID {
-		fmt.Fprintln(buffer, "Executed Gtid Set: ", executedGTIDSet)
+	var name, value string
+	for rows.Next() {
+		if err := rows.Scan(&name, &value); err != nil {
+			log.Fatalf("Error reading the snapshot coordinates: %s", err.Error())
+		}
+		switch strings.ToLower(name) {
+		case "binlog_snapshot_file":
+			status.File = value
+		case "binlog_snapshot_position":
+			status.Position, _ = strconv.ParseUint(value, 10, 64)
+		case "binlog_snapshot_gtid_executed":
+			status.SupportGTID = true
+			status.ExecutedGtidSet = value
+		}
 	}
-	buffer.Flush()
-	buffer.Close()
+	if status.File == "" {
+		log.Fatal("Error getting the master data information. Make sure that the logs are enabled. If you want to skip the collection of the master information please use the option --master-data=false. Use --help for more information.")
+	}
+	return status
 }
 
 func (this *TaskManager) WriteTablesSQL(addDropTable bool) {
+	if this.NoCreateInfo {
+		log.Debugf("Skipping the tables definitions.")
+		return
+	}
 	for _, task := range this.tasksPool {
 		buffer, _ := NewTableDefinitionBuffer(task)
 
@@ -304,21 +539,35 @@ func (this *TaskManager) WriteTablesSQL(addDropTable bool) {
 		}
 
 		fmt.Fprintf(buffer, task.Table.CreateTableSQL+";\n")
-		buffer.Flush()
+		buffer.Close()
+		this.addDefinitionFile(task.Table.GetUnescapedFullName(), buffer.Path)
 	}
 }
 
+// GetTransactions start the transactions of the workers. If lockTables is true
+// the backup lock is taken when it is available and the writes are blocked
+// while the transactions start and the replication data is collected. If
+// there are non transactional tables the writes are blocked until they are
+// dumped.
 func (this *TaskManager) GetTransactions(lockTables bool, allDatabases bool) {
 
 	var startLocking time.Time
+	var tablesLocked bool
+
+	this.lockConn = getConn(this.DB)
 
 	if lockTables {
-		log.Infof("Locking tables to get a consistent backup.")
 		startLocking = time.Now()
-		if allDatabases {
-			this.lockAllTables()
-		} else {
-			this.lockTables()
+		this.takeBackupLock()
+
+		if this.needsTablesLock() {
+			log.Infof("Locking tables to get a consistent backup.")
+			if this.useFTWRL(allDatabases) {
+				this.lockAllTables()
+			} else {
+				this.lockTables()
+			}
+			tablesLocked = true
 		}
 	}
 	log.Debug("Starting workers")
@@ -334,16 +583,45 @@ func (this *TaskManager) GetTransactions(lockTables bool, allDatabases bool) {
 
 	log.Debugf("Added %d transactions", len(this.workersDB))
 
-	if lockTables {
+	this.snapshotConsistent = this.IsolationLevel == sql.LevelRepeatableRead &&
+		(tablesLocked || this.cloneSnapshot || len(this.workersDB) == 1)
+	// The Percona backup lock blocks the writes to the non transactional
+	// tables until the end of the dump.
+	this.nonTransactionalLocked = tablesLocked || this.backupLock == backupLockTables
+
+	if this.HasNonTransactionalTables() {
+		if !this.nonTransactionalLocked {
+			log.Warningf("The non transactional tables are not locked, their data will not be consistent.")
+		} else if tablesLocked {
+			log.Infof("Keeping the tables locked until the non transactional tables are dumped.")
+			this.tablesUnlocked = make(chan bool)
+			go this.unlockAfterNonTransactional(startLocking)
+			return
+		}
+	}
+
+	if tablesLocked {
 		this.unlockTables()
 		lockedTime := time.Since(startLocking)
 		log.Infof("Unlocking the tables. Tables were locked for %s", lockedTime)
 	}
 }
 
+// unlockAfterNonTransactional unlock the tables after all the chunks of the
+// non transactional tables were dumped. It doesn't wait for the chunks of the
+// transactional tables, they are read from the snapshots.
+func (this *TaskManager) unlockAfterNonTransactional(startLocking time.Time) {
+	<-this.nonTransactionalQueued
+	this.nonTransactionalWG.Wait()
+	this.unlockTables()
+	lockedTime := time.Since(startLocking)
+	log.Infof("Unlocking the tables. Tables were locked for %s", lockedTime)
+	close(this.tablesUnlocked)
+}
+
 func (this *TaskManager) StartWorkers() error {
-	log.Infof("Starting %d workers", len(this.workersTx))
-	for i, _ := range this.workersTx {
+	log.Infof("Starting %d workers", len(this.workersConn))
+	for i, _ := range this.workersConn {
 		this.ProcessChunksWaitGroup.Add(1)
 		go this.StartWorker(i)
 	}
@@ -353,6 +631,10 @@ func (this *TaskManager) StartWorkers() error {
 
 func (this *TaskManager) DisplaySummary() error {
 	for _, task := range this.tasksPool {
+		if this.NoData {
+			fmt.Printf("   definition -> %s\n", task.Table.GetFullName())
+			continue
+		}
 		fmt.Printf("   %d -> %s\n", task.TotalChunks, task.Table.GetFullName())
 	}
 	return nil
@@ -360,9 +642,9 @@ func (this *TaskManager) DisplaySummary() error {
 
 func (this *TaskManager) PrintStatus() {
 	time.Sleep(2 * time.Second)
-	log.Infof("Status. Queue: %d of %d", this.Queue, this.TotalChunks)
-	for this.Queue > 0 {
-		log.Infof("Queue: %d of %d", this.Queue, this.TotalChunks)
+	log.Infof("Status. Queue: %d of %d", atomic.LoadInt64(&this.Queue), atomic.LoadInt64(&this.TotalChunks))
+	for atomic.LoadInt64(&this.Queue) > 0 {
+		log.Infof("Queue: %d of %d", atomic.LoadInt64(&this.Queue), atomic.LoadInt64(&this.TotalChunks))
 		time.Sleep(1 * time.Second)
 	}
 }
@@ -385,22 +667,20 @@ func (this *TaskManager) StartWorker(workerId int) {
 	var err error
 	for {
 		chunk, ok := <-this.ChunksChannel
-		this.Queue = this.Queue - 1
-		log.Debugf("Queue -1: %d ", this.Queue)
-
 		if !ok {
 			log.Debugf("Channel %d is closed.", workerId)
 			break
 		}
+		log.Debugf("Queue -1: %d ", atomic.AddInt64(&this.Queue, -1))
 
 		if query != chunk.GetPrepareSQL() {
 			query = chunk.GetPrepareSQL()
 			if stmt != nil {
 				stmt.Close()
 			}
-			stmt, err = this.workersTx[workerId].Prepare(query)
+			stmt, err = this.workersConn[workerId].PrepareContext(context.Background(), query)
 		} else {
-			stmt, err = this.workersTx[workerId].Prepare(query)
+			stmt, err = this.workersConn[workerId].PrepareContext(context.Background(), query)
 		}
 
 		if err != nil {
@@ -409,39 +689,99 @@ func (this *TaskManager) StartWorker(workerId int) {
 
 		tablename := chunk.Task.Table.GetUnescapedFullName()
 
+		// Each chunk has its own file and it is closed after parsing it.
+		if this.OutputLayout == OutputLayoutChunk {
+			tablename = fmt.Sprintf("%s.%d", tablename, chunk.Sequence)
+		}
+
 		if _, ok := bufferChunk[tablename]; !ok {
 			bufferChunk[tablename], _ = NewChunkBuffer(&chunk, workerId)
 		}
 
 		buffer := bufferChunk[tablename]
 
+		if buffer.NeedsRotation() {
+			buffer.Rotate()
+		}
+
 		if !chunk.Task.TaskManager.SkipUseDatabase {
-			fmt.Fprintf(buffer, "USE %s\n", chunk.Task.Table.GetSchema())
+			fmt.Fprintf(buffer, GetUseDatabaseSQL(chunk.Task.Table.GetSchema())+";\n")
 		}
 
 		buffer.Flush()
 
+		start := time.Now()
 		chunk.Parse(stmt, buffer)
+		if this.ChunkTargetTime > 0 {
+			chunk.Task.AddChunkDuration(chunk.Rows, time.Since(start))
+		}
 
 		stmt.Close()
+
+		if !chunk.Task.Table.IsTransactional() {
+			this.nonTransactionalWG.Done()
+		}
+
+		if this.OutputLayout == OutputLayoutChunk {
+			buffer.Close()
+			this.addDataFiles(chunk.Task.Table.GetUnescapedFullName(), buffer.Files)
+			delete(bufferChunk, tablename)
+		}
 	}
-	for _, buffer := range bufferChunk {
+	for tablename, buffer := range bufferChunk {
 		buffer.Close()
+		this.addDataFiles(tablename, buffer.Files)
+	}
+	if _, err := this.workersConn[workerId].ExecContext(context.Background(), "COMMIT"); err != nil {
+		log.Errorf("Error committing the transaction of the worker %d: %s", workerId, err.Error())
 	}
-	this.workersTx[workerId].Commit()
+	this.workersConn[workerId].Close()
 	this.ProcessChunksWaitGroup.Done()
 }
 
 func (this *TaskManager) AddChunk(chunk DataChunk) {
+	if !chunk.Task.Table.IsTransactional() {
+		this.nonTransactionalWG.Add(1)
+	}
 	this.ChunksChannel <- chunk
 }
 
 func (this *TaskManager) CreateChunks(db *sql.DB) {
 	log.Debugf("tasksPool  %v", this.tasksPool)
+	if this.NoData {
+		log.Debugf("Skipping the creation of the chunks, the data is not dumped.")
+		close(this.nonTransactionalQueued)
+		this.CreateChunksWaitGroup.Done()
+		return
+	}
+	// The chunks of the non transactional tables are queued first, so they
+	// are dumped first and the tables are unlocked as soon as possible.
 	for _, t := range this.tasksPool {
-		this.CreateChunksWaitGroup.Add(1)
-		log.Debugf("CreateChunksWaitGroup TaskManager Add %v", this.CreateChunksWaitGroup)
-		go t.CreateChunks(db)
+		if !t.Table.IsTransactional() {
+			this.CreateChunksWaitGroup.Add(1)
+			t.CreateChunks(db)
+		}
+	}
+	// All the chunks of the non transactional tables are queued.
+	close(this.nonTransactionalQueued)
+
+	// The chunks of several tables are created at the same time, up to
+	// ChunkThreads tables.
+	chunkThreads := this.ChunkThreads
+	if chunkThreads < 1 {
+		chunkThreads = 1
+	}
+	threads := make(chan bool, chunkThreads)
+	for _, t := range this.tasksPool {
+		if t.Table.IsTransactional() {
+			this.CreateChunksWaitGroup.Add(1)
+			log.Debugf("CreateChunksWaitGroup TaskManager Add %v", this.CreateChunksWaitGroup)
+			threads <- true
+			go func(t *Task) {
+				defer func() { <-threads }()
+				t.CreateChunks(db)
+			}(t)
+		}
 	}
 	this.CreateChunksWaitGroup.Done()
 	log.Debugf("CreateChunksWaitGroup TaskManager Done %v", this.CreateChunksWaitGroup)
@@ -455,5 +795,6 @@ func (this *TaskManager) GetBufferOptions() *BufferOptions {
 		bufferOptions.CompressLevel = this.CompressLevel
 	}
 	bufferOptions.Type = BufferTypeFile
+	bufferOptions.MaxFileSize = this.MaxFileSize
 	return bufferOptions
 }
@@ -57,7 +57,7 @@ var wgCreateChunks sync.WaitGroup
 // WaitGroup to process the chunks
 var wgProcessChunks sync.WaitGroup
 
-var taskManager = NewTaskManager(
+var taskManager, _ = NewTaskManager(
 	&wgCreateChunks,
 	&wgProcessChunks,
 	cDataChunk,
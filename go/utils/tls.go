@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes, with the same meaning as the --ssl-mode option of the MySQL
+// client.
+const (
+	// SSLModeDisabled doesn't use TLS.
+	SSLModeDisabled = "DISABLED"
+	// SSLModePreferred uses TLS if the server supports it.
+	SSLModePreferred = "PREFERRED"
+	// SSLModeRequired uses TLS without verifying the server certificate.
+	SSLModeRequired = "REQUIRED"
+	// SSLModeVerifyCA verifies the server certificate with the CA.
+	SSLModeVerifyCA = "VERIFY_CA"
+	// SSLModeVerifyIdentity verifies the server certificate and that the
+	// host name matches the certificate.
+	SSLModeVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+// tlsConfigName is the name of the TLS configuration registered with the
+// driver.
+const tlsConfigName = "custom"
+
+// GetSSLMode return the SSL mode to use. Without a mode it is VERIFY_CA if
+// there is a CA file, REQUIRED if there is a client certificate and PREFERRED
+// otherwise. The client certificate can't be used with PREFERRED because the
+// driver can't fall back to a connection without TLS.
+func GetSSLMode(host *MySQLHost) (string, error) {
+	mode := strings.ToUpper(host.SSLMode)
+	switch mode {
+	case "":
+		if host.SSLCA != "" {
+			return SSLModeVerifyCA, nil
+		}
+		if host.SSLCert != "" {
+			return SSLModeRequired, nil
+		}
+		return SSLModePreferred, nil
+	case SSLModePreferred:
+		if host.SSLCert != "" {
+			return "", fmt.Errorf("The SSL mode %s can not be used with a client certificate, use %s", mode, SSLModeRequired)
+		}
+		return mode, nil
+	case SSLModeDisabled, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+		return mode, nil
+	}
+	return "", fmt.Errorf("Unknown SSL mode \"%s\"", host.SSLMode)
+}
+
+// GetTLSConfig return the TLS configuration for the SSL options of the host.
+// It returns nil if the TLS configuration of the driver can be used.
+func GetTLSConfig(host *MySQLHost) (*tls.Config, error) {
+	mode, err := GetSSLMode(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if (host.SSLCert == "") != (host.SSLKey == "") {
+		return nil, fmt.Errorf("The SSL certificate and key must be used together")
+	}
+
+	if mode == SSLModeDisabled || mode == SSLModePreferred {
+		return nil, nil
+	}
+	if mode == SSLModeVerifyCA && host.SSLCA == "" {
+		return nil, fmt.Errorf("The SSL mode %s requires a CA file", mode)
+	}
+
+	config := &tls.Config{}
+
+	if host.SSLCA != "" {
+		pem, err := ioutil.ReadFile(host.SSLCA)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the CA file %s: %s", host.SSLCA, err.Error())
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Error parsing the CA file %s", host.SSLCA)
+		}
+	}
+
+	if host.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(host.SSLCert, host.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the SSL certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case SSLModeRequired:
+		config.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// The certificate is verified without the host name.
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyCertificateChain(config.RootCAs)
+	case SSLModeVerifyIdentity:
+		config.ServerName = host.HostName
+	}
+	return config, nil
+}
+
+// verifyCertificateChain return a function that verifies the certificates
+// sent by the server with the CA.
+func verifyCertificateChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("The server didn't send any certificate")
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		var leaf *x509.Certificate
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				leaf = cert
+			} else {
+				opts.Intermediates.AddCert(cert)
+			}
+		}
+		_, err := leaf.Verify(opts)
+		return err
+	}
+}
+
+// GetTLSParam register the TLS configuration with the driver and return the
+// value of the tls parameter of the DSN. It is empty without TLS.
+func GetTLSParam(host *MySQLHost) (string, error) {
+	mode, err := GetSSLMode(host)
+	if err != nil {
+		return "", err
+	}
+	config, err := GetTLSConfig(host)
+	if err != nil {
+		return "", err
+	}
+
+	if config == nil {
+		if mode == SSLModePreferred {
+			return "preferred", nil
+		}
+		return "", nil
+	}
+
+	if err := mysql.RegisterTLSConfig(tlsConfigName, config); err != nil {
+		return "", err
+	}
+	return tlsConfigName, nil
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "testing"
+
+func TestGetSSLMode(t *testing.T) {
+	values := []struct {
+		host   *MySQLHost
+		expect string
+	}{
+		{&MySQLHost{}, SSLModePreferred},
+		{&MySQLHost{SSLCA: "/tmp/ca.pem"}, SSLModeVerifyCA},
+		{&MySQLHost{SSLCert: "/tmp/cert.pem", SSLKey: "/tmp/key.pem"}, SSLModeRequired},
+		{&MySQLHost{SSLMode: "required"}, SSLModeRequired},
+		{&MySQLHost{SSLMode: "DISABLED", SSLCA: "/tmp/ca.pem"}, SSLModeDisabled},
+	}
+	for _, tt := range values {
+		mode, err := GetSSLMode(tt.host)
+		if err != nil || mode != tt.expect {
+			t.Errorf("Host %+v: got %s (%v) and expected %s", tt.host, mode, err, tt.expect)
+		}
+	}
+
+	if _, err := GetSSLMode(&MySQLHost{SSLMode: "ALWAYS"}); err == nil {
+		t.Errorf("Invalid SSL mode should fail")
+	}
+	if _, err := GetSSLMode(&MySQLHost{SSLMode: "preferred", SSLCert: "/tmp/cert.pem"}); err == nil {
+		t.Errorf("The SSL mode PREFERRED with a client certificate should fail")
+	}
+}
+
+func TestGetTLSParam(t *testing.T) {
+	values := []struct {
+		host   *MySQLHost
+		expect string
+	}{
+		{&MySQLHost{SSLMode: SSLModeDisabled}, ""},
+		{&MySQLHost{}, "preferred"},
+		{&MySQLHost{SSLMode: SSLModeRequired}, tlsConfigName},
+		{&MySQLHost{SSLMode: SSLModeVerifyIdentity, HostName: "dbhost"}, tlsConfigName},
+	}
+	for _, tt := range values {
+		param, err := GetTLSParam(tt.host)
+		if err != nil || param != tt.expect {
+			t.Errorf("Host %+v: got %s (%v) and expected %s", tt.host, param, err, tt.expect)
+		}
+	}
+
+	invalid := []*MySQLHost{
+		{SSLMode: SSLModeVerifyCA},
+		{SSLMode: SSLModeRequired, SSLCert: "/tmp/cert.pem"},
+		{SSLMode: SSLModeVerifyCA, SSLCA: "/nonexistent/ca.pem"},
+	}
+	for _, host := range invalid {
+		if _, err := GetTLSParam(host); err == nil {
+			t.Errorf("Host %+v should fail", host)
+		}
+	}
+}
+
+func TestParseSSLIniOptions(t *testing.T) {
+	do := &DumpOptions{MySQLHost: new(MySQLHost), MySQLCredentials: new(MySQLCredentials)}
+	ParseIniFile("../../test/ssl.ini", do, map[string]bool{"ssl-key": true})
+
+	if do.MySQLHost.SSLMode != "VERIFY_IDENTITY" || do.MySQLHost.SSLCA != "/etc/mysql/ca.pem" {
+		t.Errorf("The SSL options of the client section were not parsed: %+v", do.MySQLHost)
+	}
+	if do.MySQLHost.SSLCert != "/etc/mysql/client-cert.pem" {
+		t.Errorf("The SSL options of the go-dump section were not parsed: %+v", do.MySQLHost)
+	}
+	if do.MySQLHost.SSLKey != "" {
+		t.Errorf("The SSL key was set in the command line, it shouldn't change")
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -19,6 +20,14 @@ type DumpOptions struct {
 	OutputChunkSize       uint64
 	ChannelBufferSize     int
 	LockTables            bool
+	LockMode              string
+	ReplicationDataFormat string
+	ReplicationSyntax     string
+	ReplicationGTID       bool
+	LockWaitTimeout       int
+	LongQueryGuard        int
+	LongQueryAction       string
+	LongQueryWait         int
 	TablesWithoutUKOption string
 	DestinationDir        string
 	AddDropTable          bool
@@ -29,11 +38,31 @@ type DumpOptions struct {
 	CompressLevel         int
 	IsolationLevel        sql.IsolationLevel
 	Consistent            bool
+	MaskingRules          *MaskingRules
+	ExcludedColumns       map[string][]string
+	HexBlob               bool
+	InsertMode            string
+	NoData                bool
+	NoCreateInfo          bool
+	OutputLayout          string
+	MaxFileSize           uint64
+	SessionVariables      map[string]string
+	TableOptions          map[string]*TableOptions
+	ChunkStrategy         string
+	ChunkThreads          int
+	ChunkTargetSize       uint64
+	ChunkTargetTime       int
 	TemporalOptions       TemporalOptions
 }
 
 type TemporalOptions struct {
 	Tables, Databases, IsolationLevel           string
+	MaskingRulesFile, MaskingSalt               string
+	ExcludeColumns, MaxFileSize                 string
+	ChunkTargetSize                             string
+	PasswordEnv, PasswordFile                   string
+	PasswordPrompt                              bool
+	LoginPath, DSN, SessionVariables, ChunkKeys string
 	AllDatabases, Debug, DryRun, Execute, Quiet bool
 }
 
@@ -41,6 +70,12 @@ type MySQLHost struct {
 	HostName   string
 	SocketFile string
 	Port       int
+	SSLMode    string
+	SSLCA      string
+	SSLCert    string
+	SSLKey     string
+	// Params are the parameters of the driver set with --dsn.
+	Params map[string]string
 }
 
 type MySQLCredentials struct {
@@ -48,6 +83,8 @@ type MySQLCredentials struct {
 	Password string
 }
 
+// ParseString escape the special characters of a string to use it inside a
+// quoted SQL literal.
 func ParseString(s interface{}) []byte {
 
 	escape := false
@@ -66,6 +103,12 @@ func ParseString(s interface{}) []byte {
 		case byte('\r'):
 			b = byte('r')
 			escape = true
+		case byte(0):
+			b = byte('0')
+			escape = true
+		case byte('\x1a'):
+			b = byte('Z')
+			escape = true
 		}
 
 		if escape {
@@ -91,6 +134,51 @@ func TablesFromString(tablesParam string) map[string]bool {
 	return ret
 }
 
+// ColumnsFromString parse a list of comma separated columns with the format
+// "database.table.column" and return the columns grouped by table.
+func ColumnsFromString(columnsParam string) (map[string][]string, error) {
+	ret := make(map[string][]string)
+
+	for _, column := range strings.Split(columnsParam, ",") {
+		parts := strings.Split(strings.TrimSpace(column), ".")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Invalid column \"%s\", use \"database.table.column\"", column)
+		}
+		table := parts[0] + "." + parts[1]
+		ret[table] = append(ret[table], parts[2])
+	}
+	return ret, nil
+}
+
+// ParseSize parse a size in bytes with an optional suffix K, M, G or T,
+// for example "512M".
+func ParseSize(size string) (uint64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := uint64(1)
+	units := "KMGT"
+	if len(size) > 0 {
+		if i := strings.IndexByte(units, size[len(size)-1]); i >= 0 {
+			multiplier = uint64(1) << (10 * uint(i+1))
+			size = size[:len(size)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size \"%s\"", size)
+	}
+	return n * multiplier, nil
+}
+
+// GetColumnsListSQL return the list of columns escaped and separated by comma.
+func GetColumnsListSQL(columns []string) string {
+	escaped := make([]string, len(columns))
+	for i, column := range columns {
+		escaped[i] = "`" + strings.Replace(column, "`", "``", -1) + "`"
+	}
+	return strings.Join(escaped, ",")
+}
+
 func getTablesFromQuery(query string, db *sql.DB) map[string]bool {
 	ret := make(map[string]bool)
 
@@ -165,10 +253,30 @@ func GetUseDatabaseSQL(schema string) string {
 	return fmt.Sprintf("USE %s", schema)
 }
 
-func GetMasterStatusSQL() string {
+// GetMasterStatusSQL return the statement to get the binary log coordinates.
+// SHOW MASTER STATUS was replaced by SHOW BINARY LOG STATUS in MySQL 8.2 and
+// removed in 8.4.
+func GetMasterStatusSQL(version string) string {
+	if !IsMariaDB(version) && VersionAtLeast(version, 8, 2, 0) {
+		return "SHOW BINARY LOG STATUS"
+	}
 	return fmt.Sprintf("SHOW MASTER STATUS")
 }
 
+// GetSlaveStatusSQL return the statement to get the status of the replication.
+// SHOW SLAVE STATUS was replaced by SHOW REPLICA STATUS in MySQL 8.0.22 and
+// removed in 8.4. With MariaDB multi source replication all the connections
+// are returned.
+func GetSlaveStatusSQL(version string, multiSource bool) string {
+	switch {
+	case IsMariaDB(version) && multiSource:
+		return "SHOW ALL SLAVES STATUS"
+	case !IsMariaDB(version) && VersionAtLeast(version, 8, 0, 22):
+		return "SHOW REPLICA STATUS"
+	}
+	return "SHOW SLAVE STATUS"
+}
+
 func GetDropTableIfExistSQL(table string) string {
 	return fmt.Sprintf("DROP TABLE IF EXISTS %s", table)
 }
@@ -177,8 +285,40 @@ func GetShowCreateTableSQL(table string) string {
 	return fmt.Sprintf("SHOW CREATE TABLE %s", table)
 }
 
-// GetMySQLConnection return the string to connect to the mysql server
-func GetMySQLConnection(host *MySQLHost, credentials *MySQLCredentials) (*sql.DB, error) {
+// IsMariaDB return true if the server version is from MariaDB.
+func IsMariaDB(version string) bool {
+	return strings.Contains(strings.ToUpper(version), "MARIADB")
+}
+
+// parseVersion return the major, minor and patch numbers of a server version
+// like "8.0.23-log" or "10.6.12-MariaDB".
+func parseVersion(version string) [3]int {
+	var numbers [3]int
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	for i, part := range strings.SplitN(version, ".", 3) {
+		numbers[i], _ = strconv.Atoi(part)
+	}
+	return numbers
+}
+
+// VersionAtLeast return true if the server version is equal or newer than
+// major.minor.patch.
+func VersionAtLeast(version string, major, minor, patch int) bool {
+	v := parseVersion(version)
+	for i, n := range []int{major, minor, patch} {
+		if v[i] != n {
+			return v[i] > n
+		}
+	}
+	return true
+}
+
+// GetMySQLDSN return the DSN to connect to the mysql server. The session
+// parameters are sent to the driver with the parameters of the host, the
+// parameters of the host win.
+func GetMySQLDSN(host *MySQLHost, credentials *MySQLCredentials, session map[string]string) (string, error) {
 	var hoststring, userpass string
 	userpass = fmt.Sprintf("%s:%s", credentials.User, credentials.Password)
 
@@ -187,8 +327,74 @@ func GetMySQLConnection(host *MySQLHost, credentials *MySQLCredentials) (*sql.DB
 	} else {
 		hoststring = fmt.Sprintf("tcp(%s:%d)", host.HostName, host.Port)
 	}
-	log.Debugf(fmt.Sprintf("%s@%s/", userpass, hoststring))
-	db, err := sql.Open("mysql", fmt.Sprintf("%s@%s/", userpass, hoststring))
+
+	tlsParam, err := getDSNTLSParam(host)
+	if err != nil {
+		return "", fmt.Errorf("MySQL TLS configuration error: %s", err.Error())
+	}
+
+	params := url.Values{}
+	for name, value := range session {
+		params.Set(name, value)
+	}
+	for name, value := range host.Params {
+		params.Set(name, value)
+	}
+	// The tls parameter of the DSN wins, except "custom" that is the
+	// configuration of the SSL options.
+	if value, ok := host.Params["tls"]; !ok || value == tlsConfigName {
+		params.Del("tls")
+		if tlsParam != "" {
+			params.Set("tls", tlsParam)
+		}
+	}
+
+	dsn := fmt.Sprintf("%s@%s/", userpass, hoststring)
+	if len(params) > 0 {
+		dsn = dsn + "?" + params.Encode()
+	}
+	return dsn, nil
+}
+
+// getDSNTLSParam return the tls parameter of the SSL options. The tls=custom
+// parameter of the DSN asks for TLS, so without SSL options it is REQUIRED
+// instead of PREFERRED and it can't be used with DISABLED.
+func getDSNTLSParam(host *MySQLHost) (string, error) {
+	if host.Params["tls"] != tlsConfigName {
+		return GetTLSParam(host)
+	}
+
+	mode, err := GetSSLMode(host)
+	if err != nil {
+		return "", err
+	}
+	switch mode {
+	case SSLModeDisabled:
+		return "", fmt.Errorf("The tls=%s parameter of the DSN can not be used with the SSL mode %s", tlsConfigName, mode)
+	case SSLModePreferred:
+		required := *host
+		required.SSLMode = SSLModeRequired
+		return GetTLSParam(&required)
+	}
+	return GetTLSParam(host)
+}
+
+// GetMySQLConnection return the connection to the mysql server
+func GetMySQLConnection(host *MySQLHost, credentials *MySQLCredentials) (*sql.DB, error) {
+	return getMySQLConnection(host, credentials, nil)
+}
+
+func getMySQLConnection(host *MySQLHost, credentials *MySQLCredentials, session map[string]string) (*sql.DB, error) {
+	dsn, err := GetMySQLDSN(host, credentials, session)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+
+	log.Debugf("DSN: %s", RedactDSN(dsn))
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatalf("MySQL connection error: %s", err.Error())
+	}
 	err = db.Ping()
 	if err != nil {
 		log.Fatalf("MySQL connection error: %s", err.Error())
@@ -238,87 +444,199 @@ func parseMySQLIniOptions(section *ini.Section, do *DumpOptions, flagSet map[str
 			}
 		case "socket":
 			do.MySQLHost.SocketFile = section.Keys()[key].Value()
+		default:
+			if !flagSet[section.Keys()[key].Name()] {
+				setSSLOption(section.Keys()[key].Name(), section.Keys()[key].Value(), do)
+			}
 		}
 	}
 }
 
+// setSSLOption set the SSL options, they have the same name in the MySQL
+// sections and in the go-dump options.
+func setSSLOption(name string, value string, do *DumpOptions) bool {
+	switch name {
+	case "ssl-mode":
+		do.MySQLHost.SSLMode = value
+	case "ssl-ca":
+		do.MySQLHost.SSLCA = value
+	case "ssl-cert":
+		do.MySQLHost.SSLCert = value
+	case "ssl-key":
+		do.MySQLHost.SSLKey = value
+	default:
+		return false
+	}
+	return true
+}
+
 func parseIniOptions(section *ini.Section, do *DumpOptions, flagSet map[string]bool) {
-	var errInt, errBool error
 	for key := range section.Keys() {
 		if flagSet[section.Keys()[key].Name()] {
 			continue
 		}
 
-		switch section.Keys()[key].Name() {
-		case "mysql-user":
-			do.MySQLCredentials.User = section.Keys()[key].Value()
-		case "mysql-password":
-			do.MySQLCredentials.Password = section.Keys()[key].Value()
-		case "mysql-host":
-			do.MySQLHost.HostName = section.Keys()[key].Value()
-		case "mysql-port":
-			if section.Keys()[key].Value() != "" {
-				do.MySQLHost.Port, errInt = strconv.Atoi(section.Keys()[key].Value())
-			}
-		case "mysql-socket":
-			do.MySQLHost.SocketFile = section.Keys()[key].Value()
-		case "threads":
-			if section.Keys()[key].Value() != "" {
-				do.Threads, errInt = strconv.Atoi(section.Keys()[key].Value())
-			}
-		case "chunk-size":
-			do.ChunkSize, errInt = strconv.ParseUint(section.Keys()[key].Value(), 10, 64)
-		case "output-chunk-size":
-			do.OutputChunkSize, errInt = strconv.ParseUint(section.Keys()[key].Value(), 10, 64)
-		case "lock-tables":
-			do.LockTables, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "tables-without-uniquekey":
-			do.TablesWithoutUKOption = section.Keys()[key].Value()
-		case "destination":
-			do.DestinationDir = section.Keys()[key].Value()
-		case "skip-use-database":
-			do.SkipUseDatabase, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "get-master-status":
-			do.GetMasterStatus, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "get-slave-status":
-			do.LockTables, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "add-drop-table":
-			do.AddDropTable, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "compress":
-			do.Compress, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "compress-level":
-			if section.Keys()[key].Value() != "" {
-				do.CompressLevel, errInt = strconv.Atoi(section.Keys()[key].Value())
-			}
-		case "consistent":
-			do.Consistent, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "tables":
-			do.TemporalOptions.Tables = section.Keys()[key].Value()
-		case "databases":
-			do.TemporalOptions.Databases = section.Keys()[key].Value()
-		case "isolation-level":
-			do.TemporalOptions.IsolationLevel = section.Keys()[key].Value()
-		case "all-databases":
-			do.TemporalOptions.AllDatabases, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "debug":
-			do.TemporalOptions.Debug, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "dry-run":
-			do.TemporalOptions.DryRun, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "execute":
-			do.TemporalOptions.Execute, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		case "quiet":
-			do.TemporalOptions.Quiet, errBool = strconv.ParseBool(section.Keys()[key].Value())
-		default:
+		known, err := SetOption(section.Keys()[key].Name(), section.Keys()[key].Value(), do)
+		if err != nil {
+			log.Fatalf("%s", err.Error())
+		}
+		if !known {
 			log.Warningf("Unknown option %s", section.Keys()[key].Name())
 		}
+	}
+}
 
-		if errInt != nil {
-			log.Fatalf("Variable %s with the value %s can not be converted to integer. Error: %s",
-				section.Keys()[key].Name(), section.Keys()[key].Value(), errInt.Error())
+// optionAliases are the options with two names that set the same value.
+var optionAliases = map[string]string{
+	"get-master-status":  "get-source-status",
+	"get-source-status":  "get-master-status",
+	"get-slave-status":   "get-replica-status",
+	"get-replica-status": "get-slave-status",
+}
+
+// SetOptionAliases mark the other name of the aliased options that were set,
+// so the files and the environment don't override the option with the other
+// name.
+func SetOptionAliases(flagSet map[string]bool) {
+	for name, alias := range optionAliases {
+		if flagSet[name] {
+			flagSet[alias] = true
 		}
-		if errBool != nil {
-			log.Fatalf("Variable %s with the value %s can not be converted to boolean. Error: %s",
-				section.Keys()[key].Name(), section.Keys()[key].Value(), errBool.Error())
+	}
+}
+
+// SetOption set the option with the name of the command line option from its
+// value as string. It returns false if the option is unknown.
+func SetOption(name string, value string, do *DumpOptions) (bool, error) {
+	var errInt, errBool error
+	switch name {
+	case "mysql-user":
+		do.MySQLCredentials.User = value
+	case "mysql-password":
+		do.MySQLCredentials.Password = value
+	case "mysql-host":
+		do.MySQLHost.HostName = value
+	case "mysql-password-env":
+		do.TemporalOptions.PasswordEnv = value
+	case "mysql-password-file":
+		do.TemporalOptions.PasswordFile = value
+	case "mysql-password-prompt":
+		do.TemporalOptions.PasswordPrompt, errBool = strconv.ParseBool(value)
+	case "login-path":
+		do.TemporalOptions.LoginPath = value
+	case "dsn":
+		do.TemporalOptions.DSN = value
+	case "session-variables":
+		do.TemporalOptions.SessionVariables = value
+	case "mysql-port":
+		if value != "" {
+			do.MySQLHost.Port, errInt = strconv.Atoi(value)
 		}
+	case "mysql-socket":
+		do.MySQLHost.SocketFile = value
+	case "threads":
+		if value != "" {
+			do.Threads, errInt = strconv.Atoi(value)
+		}
+	case "chunk-size":
+		do.ChunkSize, errInt = strconv.ParseUint(value, 10, 64)
+	case "output-chunk-size":
+		do.OutputChunkSize, errInt = strconv.ParseUint(value, 10, 64)
+	case "channel-buffer-size":
+		do.ChannelBufferSize, errInt = strconv.Atoi(value)
+	case "lock-tables":
+		do.LockTables, errBool = strconv.ParseBool(value)
+	case "lock-mode":
+		do.LockMode = value
+	case "lock-wait-timeout":
+		do.LockWaitTimeout, errInt = strconv.Atoi(value)
+	case "long-query-guard":
+		do.LongQueryGuard, errInt = strconv.Atoi(value)
+	case "long-query-action":
+		do.LongQueryAction = value
+	case "long-query-wait":
+		do.LongQueryWait, errInt = strconv.Atoi(value)
+	case "tables-without-uniquekey":
+		do.TablesWithoutUKOption = value
+	case "destination":
+		do.DestinationDir = value
+	case "skip-use-database":
+		do.SkipUseDatabase, errBool = strconv.ParseBool(value)
+	case "replication-data-format":
+		do.ReplicationDataFormat = value
+	case "replication-syntax":
+		do.ReplicationSyntax = value
+	case "replication-gtid":
+		do.ReplicationGTID, errBool = strconv.ParseBool(value)
+	case "get-master-status", "get-source-status":
+		do.GetMasterStatus, errBool = strconv.ParseBool(value)
+	case "get-slave-status", "get-replica-status":
+		do.GetSlaveStatus, errBool = strconv.ParseBool(value)
+	case "max-file-size":
+		do.TemporalOptions.MaxFileSize = value
+	case "output-layout":
+		do.OutputLayout = value
+	case "no-data":
+		do.NoData, errBool = strconv.ParseBool(value)
+	case "no-create-info":
+		do.NoCreateInfo, errBool = strconv.ParseBool(value)
+	case "add-drop-table":
+		do.AddDropTable, errBool = strconv.ParseBool(value)
+	case "insert-mode":
+		do.InsertMode = value
+	case "hex-blob":
+		do.HexBlob, errBool = strconv.ParseBool(value)
+	case "compress":
+		do.Compress, errBool = strconv.ParseBool(value)
+	case "compress-level":
+		if value != "" {
+			do.CompressLevel, errInt = strconv.Atoi(value)
+		}
+	case "consistent":
+		do.Consistent, errBool = strconv.ParseBool(value)
+	case "tables":
+		do.TemporalOptions.Tables = value
+	case "databases":
+		do.TemporalOptions.Databases = value
+	case "isolation-level":
+		do.TemporalOptions.IsolationLevel = value
+	case "masking-rules":
+		do.TemporalOptions.MaskingRulesFile = value
+	case "masking-salt":
+		do.TemporalOptions.MaskingSalt = value
+	case "exclude-columns":
+		do.TemporalOptions.ExcludeColumns = value
+	case "chunk-keys":
+		do.TemporalOptions.ChunkKeys = value
+	case "chunk-strategy":
+		do.ChunkStrategy = value
+	case "chunk-threads":
+		do.ChunkThreads, errInt = strconv.Atoi(value)
+	case "chunk-target-size":
+		do.TemporalOptions.ChunkTargetSize = value
+	case "chunk-target-time":
+		do.ChunkTargetTime, errInt = strconv.Atoi(value)
+	case "all-databases":
+		do.TemporalOptions.AllDatabases, errBool = strconv.ParseBool(value)
+	case "debug":
+		do.TemporalOptions.Debug, errBool = strconv.ParseBool(value)
+	case "dry-run":
+		do.TemporalOptions.DryRun, errBool = strconv.ParseBool(value)
+	case "execute":
+		do.TemporalOptions.Execute, errBool = strconv.ParseBool(value)
+	case "quiet":
+		do.TemporalOptions.Quiet, errBool = strconv.ParseBool(value)
+	default:
+		return setSSLOption(name, value, do), nil
+	}
+
+	if errInt != nil {
+		return true, fmt.Errorf("Variable %s with the value %s can not be converted to integer. Error: %s",
+			name, value, errInt.Error())
+	}
+	if errBool != nil {
+		return true, fmt.Errorf("Variable %s with the value %s can not be converted to boolean. Error: %s",
+			name, value, errBool.Error())
 	}
+	return true, nil
 }
@@ -0,0 +1,94 @@
+package utils
+
+import "testing"
+
+func TestColumnsFromString(t *testing.T) {
+	columns, err := ColumnsFromString("db1.table1.col1,db1.table1.col2, db2.table2.col1")
+	if err != nil {
+		t.Fatalf("Error parsing the columns: %s", err.Error())
+	}
+	if len(columns["db1.table1"]) != 2 || len(columns["db2.table2"]) != 1 {
+		t.Fatalf("Got %v and expected 2 columns for db1.table1 and 1 for db2.table2", columns)
+	}
+
+	if _, err := ColumnsFromString("db1.col1"); err == nil {
+		t.Fatalf("Column without table should fail")
+	}
+}
+
+func TestGetColumnsListSQL(t *testing.T) {
+	list := GetColumnsListSQL([]string{"id", "first name", "we`ird"})
+	if list != "`id`,`first name`,`we``ird`" {
+		t.Fatalf("Got %s", list)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	sizes := []struct {
+		size   string
+		expect uint64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"10k", 10240},
+		{"512M", 512 << 20},
+		{"2G", 2 << 30},
+		{"1T", 1 << 40},
+	}
+	for _, tt := range sizes {
+		got, err := ParseSize(tt.size)
+		if err != nil || got != tt.expect {
+			t.Errorf("Size %s is %d and we expect %d", tt.size, got, tt.expect)
+		}
+	}
+
+	if _, err := ParseSize("10X"); err == nil {
+		t.Errorf("Size 10X should fail")
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	values := []struct {
+		version string
+		expect  bool
+	}{
+		{"8.0.23", true},
+		{"8.0.23-log", true},
+		{"8.0.4-rc", false},
+		{"8.4.0", true},
+		{"5.7.42-log", false},
+		{"10.6.12-MariaDB", true},
+		{"", false},
+	}
+	for _, tt := range values {
+		if got := VersionAtLeast(tt.version, 8, 0, 23); got != tt.expect {
+			t.Errorf("Version %s: got %t and expected %t", tt.version, got, tt.expect)
+		}
+	}
+}
+
+func TestGetStatusSQL(t *testing.T) {
+	masterStatus := map[string]string{
+		"5.7.42":          "SHOW MASTER STATUS",
+		"8.0.36":          "SHOW MASTER STATUS",
+		"8.4.0":           "SHOW BINARY LOG STATUS",
+		"10.11.6-MariaDB": "SHOW MASTER STATUS",
+	}
+	for version, expect := range masterStatus {
+		if got := GetMasterStatusSQL(version); got != expect {
+			t.Errorf("Master status of %s: got %s and expected %s", version, got, expect)
+		}
+	}
+
+	slaveStatus := map[string]string{
+		"5.7.42":          "SHOW SLAVE STATUS",
+		"8.0.22":          "SHOW REPLICA STATUS",
+		"8.4.0":           "SHOW REPLICA STATUS",
+		"10.11.6-MariaDB": "SHOW ALL SLAVES STATUS",
+	}
+	for version, expect := range slaveStatus {
+		if got := GetSlaveStatusSQL(version, IsMariaDB(version)); got != expect {
+			t.Errorf("Slave status of %s: got %s and expected %s", version, got, expect)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnFormat contains the information of a column needed to write its
+// values as SQL literals. If HexBlob is true the binary and BIT columns are
+// written as hexadecimal literals. Length is the maximum length of the text
+// and binary columns, 0 if it is unknown.
+type ColumnFormat struct {
+	Name      string
+	TypeName  string
+	Precision int64
+	Scale     int64
+	Length    int64
+	HexBlob   bool
+}
+
+// NewColumnFormat create a ColumnFormat from the column type returned by the
+// driver.
+func NewColumnFormat(column *sql.ColumnType, hexBlob bool) *ColumnFormat {
+	format := &ColumnFormat{
+		Name:     column.Name(),
+		TypeName: strings.ToUpper(column.DatabaseTypeName()),
+		HexBlob:  hexBlob,
+	}
+	if precision, scale, ok := column.DecimalSize(); ok {
+		format.Precision = precision
+		format.Scale = scale
+	}
+	return format
+}
+
+// NewColumnFormats create the ColumnFormat for each column of a result.
+func NewColumnFormats(columns []*sql.ColumnType, hexBlob bool) []*ColumnFormat {
+	formats := make([]*ColumnFormat, len(columns))
+	for i, column := range columns {
+		formats[i] = NewColumnFormat(column, hexBlob)
+	}
+	return formats
+}
+
+// GetColumnsNames return the names of the columns.
+func GetColumnsNames(formats []*ColumnFormat) []string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = format.Name
+	}
+	return names
+}
+
+// IsBinary return true if the column stores binary data.
+func (this *ColumnFormat) IsBinary() bool {
+	switch this.TypeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+		return true
+	}
+	return false
+}
+
+// IsSpatial return true if the column is a spatial type. The driver returns
+// these values in the internal format of the server.
+func (this *ColumnFormat) IsSpatial() bool {
+	switch this.TypeName {
+	case "GEOMETRY", "POINT", "LINESTRING", "POLYGON", "MULTIPOINT",
+		"MULTILINESTRING", "MULTIPOLYGON", "GEOMETRYCOLLECTION", "GEOMCOLLECTION":
+		return true
+	}
+	return false
+}
+
+// IsNumeric return true if the column values can be written without quotes.
+func (this *ColumnFormat) IsNumeric() bool {
+	switch strings.TrimPrefix(this.TypeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL",
+		"FLOAT", "DOUBLE", "YEAR":
+		return true
+	}
+	return false
+}
+
+// IsUnsigned return true if the numeric column is unsigned.
+func (this *ColumnFormat) IsUnsigned() bool {
+	return strings.HasPrefix(this.TypeName, "UNSIGNED ")
+}
+
+// maxDecimalDigits is the number of integer digits of a DECIMAL that fit in
+// an int64.
+const maxDecimalDigits = 18
+
+// IntegerRange return the minimum and the maximum integers that can be stored
+// in the numeric column. The FLOAT and DOUBLE columns use the range of INT.
+func (this *ColumnFormat) IntegerRange() (int64, uint64) {
+	bits := uint(32)
+	switch strings.TrimPrefix(this.TypeName, "UNSIGNED ") {
+	case "TINYINT":
+		bits = 8
+	case "SMALLINT":
+		bits = 16
+	case "MEDIUMINT":
+		bits = 24
+	case "BIGINT":
+		bits = 64
+	case "YEAR":
+		return 1901, 2155
+	case "DECIMAL":
+		if this.Precision > 0 {
+			digits := this.Precision - this.Scale
+			if digits > maxDecimalDigits {
+				digits = maxDecimalDigits
+			}
+			max := uint64(1)
+			for i := int64(0); i < digits; i++ {
+				max *= 10
+			}
+			max--
+			if this.IsUnsigned() {
+				return 0, max
+			}
+			return -int64(max), max
+		}
+	}
+
+	if this.IsUnsigned() {
+		return 0, 1<<bits - 1
+	}
+	return -1 << (bits - 1), 1<<(bits-1) - 1
+}
+
+// Format return the value as a SQL literal.
+func (this *ColumnFormat) Format(value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return []byte("NULL")
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case uint64:
+		return strconv.AppendUint(nil, v, 10)
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64)
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case time.Time:
+		return this.formatTime(v)
+	case []byte:
+		return this.formatBytes(v)
+	case string:
+		return this.formatBytes([]byte(v))
+	default:
+		return this.formatBytes([]byte(fmt.Sprintf("%v", v)))
+	}
+}
+
+// formatBytes write the values returned as bytes by the driver depending on
+// the type of the column.
+func (this *ColumnFormat) formatBytes(b []byte) []byte {
+	switch {
+	case this.TypeName == "BIT" && this.HexBlob:
+		return formatHex(b)
+	case this.TypeName == "BIT":
+		return formatBits(b)
+	case this.IsBinary() && this.HexBlob, this.IsSpatial():
+		return formatHex(b)
+	case this.IsBinary():
+		// The introducer avoids the conversion from the connection charset.
+		return append([]byte("_binary"), quote(ParseString(b))...)
+	case this.IsNumeric() && isNumericLiteral(b):
+		// DECIMAL values are exact strings, we keep them as they are.
+		return b
+	}
+	return quote(ParseString(b))
+}
+
+// isNumericLiteral return true if the value is a decimal number that can be
+// written without quotes, like "-12", "3.50" or "1.5e-3".
+func isNumericLiteral(b []byte) bool {
+	i := 0
+	if i < len(b) && (b[i] == '-' || b[i] == '+') {
+		i++
+	}
+	digits := 0
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		digits++
+	}
+	if i < len(b) && b[i] == '.' {
+		for i++; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return false
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '-' || b[i] == '+') {
+			i++
+		}
+		exponent := i
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		}
+		if i == exponent {
+			return false
+		}
+	}
+	return i == len(b)
+}
+
+// formatTime write a time.Time value with the fractional seconds of the
+// column.
+func (this *ColumnFormat) formatTime(t time.Time) []byte {
+	if this.TypeName == "DATE" {
+		return quote([]byte(t.Format("2006-01-02")))
+	}
+
+	layout := "2006-01-02 15:04:05"
+	if this.Scale > 0 && this.Scale <= 6 {
+		layout = layout + "." + strings.Repeat("0", int(this.Scale))
+	} else if t.Nanosecond() != 0 {
+		layout = layout + ".999999"
+	}
+	return quote([]byte(t.Format(layout)))
+}
+
+// formatHex return the value as an hexadecimal literal.
+func formatHex(b []byte) []byte {
+	if len(b) == 0 {
+		return []byte("''")
+	}
+	ret := make([]byte, 2+hex.EncodedLen(len(b)))
+	ret[0], ret[1] = '0', 'x'
+	hex.Encode(ret[2:], b)
+	return ret
+}
+
+// formatBits return the value as a bit-value literal.
+func formatBits(b []byte) []byte {
+	if len(b) == 0 {
+		return []byte("b'0'")
+	}
+	ret := []byte("b'")
+	for _, c := range b {
+		ret = append(ret, fmt.Sprintf("%08b", c)...)
+	}
+	return append(ret, '\'')
+}
+
+func quote(b []byte) []byte {
+	ret := make([]byte, 0, len(b)+2)
+	ret = append(ret, '\'')
+	ret = append(ret, b...)
+	return append(ret, '\'')
+}
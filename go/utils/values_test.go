@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestColumnFormatEscaping(t *testing.T) {
+	values := []struct {
+		format *ColumnFormat
+		value  []byte
+		expect []byte
+	}{
+		// NUL, backslash, quote and Ctrl+Z are written with their escape
+		// sequences.
+		{&ColumnFormat{TypeName: "VARCHAR"}, []byte{'a', 0x00, 'b'}, []byte{'\'', 'a', '\\', '0', 'b', '\''}},
+		{&ColumnFormat{TypeName: "VARCHAR"}, []byte{'a', '\\', 'b'}, []byte{'\'', 'a', '\\', '\\', 'b', '\''}},
+		{&ColumnFormat{TypeName: "VARCHAR"}, []byte{'a', '\'', 'b'}, []byte{'\'', 'a', '\\', '\'', 'b', '\''}},
+		{&ColumnFormat{TypeName: "TEXT"}, []byte{'a', 0x1a, 'b'}, []byte{'\'', 'a', '\\', 'Z', 'b', '\''}},
+		{&ColumnFormat{TypeName: "TEXT"}, []byte{'\n', '\r', '"'}, []byte{'\'', '\\', 'n', '\\', 'r', '\\', '"', '\''}},
+		// Invalid UTF-8 is kept byte by byte in the binary strings.
+		{&ColumnFormat{TypeName: "BLOB"}, []byte{0xff, 0x00, '\''}, []byte{'_', 'b', 'i', 'n', 'a', 'r', 'y', '\'', 0xff, '\\', '0', '\\', '\'', '\''}},
+		{&ColumnFormat{TypeName: "VARBINARY"}, []byte{0xc3, 0x28, 0x1a, '\\'}, []byte{'_', 'b', 'i', 'n', 'a', 'r', 'y', '\'', 0xc3, 0x28, '\\', 'Z', '\\', '\\', '\''}},
+		{&ColumnFormat{TypeName: "BINARY"}, []byte{}, []byte{'_', 'b', 'i', 'n', 'a', 'r', 'y', '\'', '\''}},
+		// The hexadecimal literals do not need any escaping.
+		{&ColumnFormat{TypeName: "BLOB", HexBlob: true}, []byte{0xff, 0xc3, 0x28, 0x00}, []byte("0xffc32800")},
+		{&ColumnFormat{TypeName: "VARBINARY", HexBlob: true}, []byte{'\'', '\\', 0x1a}, []byte("0x275c1a")},
+		{&ColumnFormat{TypeName: "GEOMETRY"}, []byte{0x00, 0xfe, 0xff}, []byte("0x00feff")},
+		{&ColumnFormat{TypeName: "BLOB", HexBlob: true}, []byte{}, []byte("''")},
+	}
+
+	for _, tt := range values {
+		if got := tt.format.Format(tt.value); !bytes.Equal(got, tt.expect) {
+			t.Errorf("%s: value % x written as % x and expected % x", tt.format.TypeName, tt.value, got, tt.expect)
+		}
+	}
+}
+
+func TestColumnFormatLiterals(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 120000000, time.UTC)
+
+	values := []struct {
+		format *ColumnFormat
+		value  interface{}
+		expect string
+	}{
+		{&ColumnFormat{TypeName: "INT"}, nil, "NULL"},
+		{&ColumnFormat{TypeName: "BIGINT"}, int64(-42), "-42"},
+		{&ColumnFormat{TypeName: "UNSIGNED BIGINT"}, uint64(18446744073709551615), "18446744073709551615"},
+		{&ColumnFormat{TypeName: "DOUBLE"}, float64(0.1), "0.1"},
+		{&ColumnFormat{TypeName: "FLOAT"}, float32(0.1), "0.1"},
+		{&ColumnFormat{TypeName: "DECIMAL"}, []byte("10.50"), "10.50"},
+		{&ColumnFormat{TypeName: "UNSIGNED INT"}, []byte("10"), "10"},
+		{&ColumnFormat{TypeName: "INT"}, []byte("1e3"), "1e3"},
+		{&ColumnFormat{TypeName: "INT"}, []byte("1 OR 1"), "'1 OR 1'"},
+		{&ColumnFormat{TypeName: "DECIMAL"}, []byte("-"), "'-'"},
+		{&ColumnFormat{TypeName: "BLOB"}, []byte{0xca, '\''}, "_binary'\xca\\''"},
+		{&ColumnFormat{TypeName: "BLOB", HexBlob: true}, []byte{0xca, 0xfe}, "0xcafe"},
+		{&ColumnFormat{TypeName: "VARBINARY", HexBlob: true}, []byte("go"), "0x676f"},
+		{&ColumnFormat{TypeName: "GEOMETRY"}, []byte{0x01}, "0x01"},
+		{&ColumnFormat{TypeName: "VARCHAR", HexBlob: true}, []byte("go"), "'go'"},
+		{&ColumnFormat{TypeName: "BIT"}, []byte{0x05}, "b'00000101'"},
+		{&ColumnFormat{TypeName: "BIT", HexBlob: true}, []byte{0x05}, "0x05"},
+		{&ColumnFormat{TypeName: "VARCHAR"}, []byte("a'b"), "'a\\'b'"},
+		{&ColumnFormat{TypeName: "DATETIME"}, date, "'2020-01-02 03:04:05.12'"},
+		{&ColumnFormat{TypeName: "DATETIME", Scale: 6}, date, "'2020-01-02 03:04:05.120000'"},
+		{&ColumnFormat{TypeName: "TIMESTAMP"}, date.Truncate(time.Second), "'2020-01-02 03:04:05'"},
+		{&ColumnFormat{TypeName: "DATE"}, date, "'2020-01-02'"},
+	}
+
+	for _, tt := range values {
+		if got := string(tt.format.Format(tt.value)); got != tt.expect {
+			t.Errorf("%s: got %s and expected %s", tt.format.TypeName, got, tt.expect)
+		}
+	}
+}